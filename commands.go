@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"solar/epever"
+)
+
+// command is a one shot action run against a single controller instead of monitoring
+type command struct {
+	args string
+	help string
+	run  func(ep *epever.Epever, args []string) error
+}
+
+var commands = map[string]command{
+	"coil":           {"[name [on|off]]", "List the coils, show one or switch it", coilCommand},
+	"sync-rtc":       {"", "Set the controller clock from the host clock in -timezone", syncRTCCommand},
+	"load-config":    {"[name=value ...]", "Show the load and light control settings, or change some and write them", loadConfigCommand},
+	"backup":         {"file.json|file.yaml", "Save every writable holding register to a file", backupCommand},
+	"restore":        {"[-y] file.json|file.yaml", "Show what restoring a backup would change, then write it", restoreCommand},
+	"apply-profile":  {"[-dry-run] [-voltage 24] [-profiles file.yaml] [name]", "List the battery profiles, or write one scaled to the system voltage", applyProfileCommand},
+	"battery-config": {"[name=value ...]", "Show the battery settings, or change some and write the block back", batteryConfigCommand},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command]\n\nWith no command the controllers are monitored and exported to prometheus.\n\nCommands:\n", os.Args[0])
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := commands[name]
+		fmt.Fprintf(out, "  %s %s\n    \t%s\n", name, c.args, c.help)
+	}
+	fmt.Fprintf(out, "\nFlags, each of which can also be set in the environment as SOLAR_ and its name, eg SOLAR_STALE_POLLS=5:\n")
+	flag.PrintDefaults()
+}
+
+// commandContext bounds a one shot command to one update period
+func commandContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), updatePeriod)
+}
+
+// coilCommand lists, shows or switches coils. Names are the register map
+// names with or without the Coil prefix, eg ManualLoad or coilmanualload.
+func coilCommand(ep *epever.Epever, args []string) error {
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	coils := epever.CoilRegisters()
+	if len(args) > 0 {
+		r, err := lookupCoil(args[0])
+		if err != nil {
+			return err
+		}
+		coils = []epever.Register{r}
+	}
+
+	if len(args) == 2 {
+		var on bool
+		switch strings.ToLower(args[1]) {
+		case "on", "1", "true":
+			on = true
+		case "off", "0", "false":
+		default:
+			return fmt.Errorf("want on or off, not %q", args[1])
+		}
+		if err := ep.WriteCoil(ctx, coils[0].Address, on); err != nil {
+			return err
+		}
+	} else if len(args) > 2 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	for _, r := range coils {
+		on, err := ep.ReadCoil(ctx, r.Address)
+		if err != nil {
+			return err
+		}
+		state := "off"
+		if on {
+			state = "on"
+		}
+		fmt.Printf("%-18s 0x%04x %s\n", strings.TrimPrefix(r.Name, "Coil"), r.Address, state)
+	}
+	return nil
+}
+
+// lookupCoil finds a coil by name, with or without the Coil prefix
+func lookupCoil(name string) (epever.Register, error) {
+	r, ok := epever.LookupRegister(name)
+	if !ok || r.Table != epever.Coil {
+		r, ok = epever.LookupRegister("Coil" + name)
+	}
+	if !ok || r.Table != epever.Coil {
+		return epever.Register{}, fmt.Errorf("no coil named %q", name)
+	}
+	return r, nil
+}
+
+// batteryConfigCommand shows the battery settings, or changes the named ones
+// and writes the whole block back, eg battery-config BoostChargingVoltage=28.8
+func batteryConfigCommand(ep *epever.Epever, args []string) error {
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	c, err := ep.ReadBatteryConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		if err := setAll(&c, args); err != nil {
+			return err
+		}
+		if err := ep.SetBatteryConfig(ctx, c); err != nil {
+			return err
+		}
+	}
+	printFields(ep.Snapshot().BatteryConfig())
+	return nil
+}
+
+// loadConfigCommand shows the load settings, or changes the named ones and
+// writes them, eg load-config Mode=TimeControl TurnOn1=18:30 TurnOff1=23:00
+func loadConfigCommand(ep *epever.Epever, args []string) error {
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	c, err := ep.ReadLoadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		if err := setAll(&c, args); err != nil {
+			return err
+		}
+		if err := ep.SetLoadConfig(ctx, c); err != nil {
+			return err
+		}
+	}
+	printFields(ep.Snapshot().LoadConfig())
+	return nil
+}
+
+// setAll applies name=value arguments to a settings struct with a Set method
+func setAll(settings interface {
+	Set(name, value string) error
+}, args []string) error {
+	for _, arg := range args {
+		nameValue := strings.SplitN(arg, "=", 2)
+		if len(nameValue) != 2 {
+			return fmt.Errorf("want name=value, not %q", arg)
+		}
+		if err := settings.Set(nameValue[0], nameValue[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printFields shows a settings struct one field per line
+func printFields(v interface{}) {
+	rv := reflect.ValueOf(v)
+	for i := 0; i < rv.NumField(); i++ {
+		fmt.Printf("%-34s %v\n", rv.Type().Field(i).Name, rv.Field(i).Interface())
+	}
+}
+
+// syncRTCCommand sets the controller clock and shows how far out it was
+func syncRTCCommand(ep *epever.Epever, args []string) error {
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	before, err := ep.ReadRTC(ctx, timezone)
+	if err != nil {
+		return err
+	}
+	now, err := ep.SetRTC(ctx, hostTime)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Clock was %s, %v out, now %s\n", before.Format(time.RFC3339), before.Sub(now).Round(time.Second), now.Format(time.RFC3339))
+	return nil
+}
+
+// backupFormat is the backup file format, from the file name
+func backupFormat(file string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+}
+
+// backupCommand saves every writable holding register to a json or yaml file
+func backupCommand(ep *epever.Epever, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("want one file name")
+	}
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	backup, err := ep.Backup(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := backup.Marshal(backupFormat(args[0]))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(args[0], data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %d registers of %s to %s\n", len(backup.Registers), backup.Model, args[0])
+	return nil
+}
+
+// restoreCommand shows the registers a backup would change and, once
+// confirmed, writes them
+func restoreCommand(ep *epever.Epever, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	yes := flags.Bool("y", false, "Write without asking")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("want one file name")
+	}
+	file := flags.Arg(0)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	backup, err := epever.UnmarshalBackup(data, backupFormat(file))
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	// The diff and the restore each get their own deadline, so the time
+	// spent at the prompt does not count against the writes
+	fmt.Printf("Backup of %s slave %d on %s taken %s\n", backup.Model, backup.SlaveID, backup.Device, backup.Taken.Local().Format(time.RFC3339))
+	ctx, cancel := commandContext()
+	changes, err := ep.DiffBackup(ctx, backup)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println("Nothing to change")
+		return nil
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	if !*yes && !confirm(fmt.Sprintf("Write %d registers to %s?", len(changes), ep.Name())) {
+		return fmt.Errorf("not confirmed")
+	}
+
+	ctx, cancel = commandContext()
+	defer cancel()
+	changes, err = ep.Restore(ctx, backup)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d registers\n", len(changes))
+	return nil
+}
+
+// confirm asks a yes/no question on the terminal
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// applyProfileCommand lists the battery profiles, or scales one to the system
+// voltage and writes it, showing the settings it changes
+func applyProfileCommand(ep *epever.Epever, args []string) error {
+	flags := flag.NewFlagSet("apply-profile", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Show the changes without writing them")
+	voltage := flags.Float64("voltage", 0, "System voltage to scale the profile to, read from the controller by default")
+	profileFile := flags.String("profiles", "", "Json or yaml file of more profiles by name")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	profiles := map[string]epever.BatteryProfile{}
+	for name, p := range epever.BuiltinProfiles {
+		profiles[name] = p
+	}
+	if *profileFile != "" {
+		data, err := ioutil.ReadFile(*profileFile)
+		if err != nil {
+			return err
+		}
+		user, err := epever.UnmarshalProfiles(data, backupFormat(*profileFile))
+		if err != nil {
+			return fmt.Errorf("%s: %v", *profileFile, err)
+		}
+		for name, p := range user {
+			profiles[name] = p
+		}
+	}
+	if flags.NArg() == 0 {
+		for _, name := range epever.ProfileNames(profiles) {
+			fmt.Printf("%-12s %vV\n", name, profiles[name].Nominal)
+		}
+		return nil
+	}
+	profile, ok := profiles[flags.Arg(0)]
+	if !ok {
+		return fmt.Errorf("no profile named %q", flags.Arg(0))
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	if *voltage == 0 {
+		v, err := ep.ReadSystemVoltage(ctx)
+		if err != nil {
+			return fmt.Errorf("%v, give it with -voltage", err)
+		}
+		*voltage = v
+	}
+	current, err := ep.ReadBatteryConfig(ctx)
+	if err != nil {
+		return err
+	}
+	c, err := profile.Config(*voltage, current.Capacity)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s at %vV\n", flags.Arg(0), *voltage)
+	printChanges(current, c)
+	if current == c {
+		return nil
+	}
+	if *dryRun {
+		ep.Writes.DryRun = true
+	}
+	return ep.SetBatteryConfig(ctx, c)
+}
+
+// printChanges shows the fields that differ between two settings structs
+func printChanges(from, to interface{}) {
+	fv, tv := reflect.ValueOf(from), reflect.ValueOf(to)
+	for i := 0; i < fv.NumField(); i++ {
+		if a, b := fv.Field(i).Interface(), tv.Field(i).Interface(); a != b {
+			fmt.Printf("%-34s %v -> %v\n", fv.Type().Field(i).Name, a, b)
+		}
+	}
+}
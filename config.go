@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"solar/epever"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// config describes the installation: the ports and the controllers on them,
+// the site, and how the readings are exported. It is read from a yaml or toml
+// file given with -config. SOLAR_* environment variables override the file,
+// and flags override both.
+type config struct {
+	Timezone     string       `yaml:"timezone" toml:"timezone"`           // Of the controller clocks
+	UpdatePeriod duration     `yaml:"update_period" toml:"update_period"` // Show, sync and check the controllers this often
+	Ports        []portConfig `yaml:"ports" toml:"ports"`
+	Site         siteConfig   `yaml:"site" toml:"site"`
+
+	Poll    map[string]duration `yaml:"poll" toml:"poll"`         // Interval by poll group name, 0 for static
+	SyncRTC duration            `yaml:"sync_rtc" toml:"sync_rtc"` // Set the controller clocks this often, 0 to never
+	Desired string              `yaml:"desired" toml:"desired"`   // Desired settings file
+	Enforce bool                `yaml:"enforce" toml:"enforce"`
+	DryRun  bool                `yaml:"dry_run" toml:"dry_run"`
+	Audit   string              `yaml:"audit" toml:"audit"` // File written registers are appended to
+
+	Exporters exportersConfig `yaml:"exporters" toml:"exporters"`
+}
+
+// portConfig is one bus and the controllers on it
+type portConfig struct {
+	Address string         `yaml:"address" toml:"address"` // Any form -address takes
+	Baud    int            `yaml:"baud" toml:"baud"`       // Serial speed, 0 for the address's own
+	Timeout duration       `yaml:"timeout" toml:"timeout"` // Per request, 0 for the address's own
+	Devices []deviceConfig `yaml:"devices" toml:"devices"`
+}
+
+// deviceConfig is one controller on a port
+type deviceConfig struct {
+	SlaveID int    `yaml:"slave_id" toml:"slave_id"`
+	Name    string `yaml:"name" toml:"name"`
+}
+
+// siteConfig is what the controllers can't tell about the installation,
+// exported as solar_config_* metrics
+type siteConfig struct {
+	Panels        int     `yaml:"panels" toml:"panels"`
+	MaxPowerWatts float64 `yaml:"max_power_watts" toml:"max_power_watts"`
+	Batteries     int     `yaml:"batteries" toml:"batteries"`
+}
+
+// exportersConfig is where the readings go
+type exportersConfig struct {
+	Prometheus prometheusConfig `yaml:"prometheus" toml:"prometheus"`
+	Console    consoleConfig    `yaml:"console" toml:"console"`
+}
+
+type prometheusConfig struct {
+	Listen        string `yaml:"listen" toml:"listen"` // Address /metrics is served on, "" for no endpoint
+	LegacyMetrics bool   `yaml:"legacy_metrics" toml:"legacy_metrics"`
+	StalePolls    int    `yaml:"stale_polls" toml:"stale_polls"` // Realtime polls after which values are dropped, 0 for never
+}
+
+type consoleConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"` // Print every controller each update period
+}
+
+// defaultConfig is a single controller on the Exar USB adapter
+func defaultConfig() config {
+	poll := map[string]duration{}
+	for g, d := range epever.DefaultPollIntervals {
+		poll[g.String()] = duration(d)
+	}
+	return config{
+		Timezone:     "Local",
+		UpdatePeriod: duration(time.Minute),
+		Ports:        []portConfig{{Address: "/dev/ttyXRUSB0", Devices: []deviceConfig{{SlaveID: 1}}}},
+		Site:         siteConfig{Panels: 6, MaxPowerWatts: 600, Batteries: 4},
+		Poll:         poll,
+		Exporters: exportersConfig{
+			Prometheus: prometheusConfig{Listen: ":2112", StalePolls: 3},
+			Console:    consoleConfig{Enabled: true},
+		},
+	}
+}
+
+// duration is a time.Duration written like 5s or 1h30m, in files and flags
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("want a duration like 5s, not %q", text)
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d *duration) Set(s string) error { return d.UnmarshalText([]byte(s)) }
+func (d duration) String() string      { return time.Duration(d).String() }
+
+// load reads a yaml or toml config file, by its name, over the config. Ports
+// in the file replace the default port rather than adding to it. Unknown
+// settings are errors, so a typo isn't silently ignored.
+func (c *config) load(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	ports := c.Ports
+	c.Ports = nil
+	switch format := backupFormat(file); format {
+	case "yaml", "yml":
+		d := yaml.NewDecoder(bytes.NewReader(data))
+		d.KnownFields(true)
+		if err := d.Decode(c); err != nil && err != io.EOF {
+			return err
+		}
+	case "toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown setting %q", undecoded[0].String())
+		}
+	default:
+		return fmt.Errorf("unknown config format %q, want yaml or toml", format)
+	}
+	if c.Ports == nil {
+		c.Ports = ports
+	}
+	return nil
+}
+
+// envName is the environment variable that can give a flag, eg SOLAR_STALE_POLLS
+func envName(flagName string) string {
+	return "SOLAR_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// parseConfig parses the flags, some of which are bound to cfg, over the
+// config file they name. Each flag can also be set in the environment, which
+// the command line overrides. It returns the names of the flags set either way.
+func parseConfig(fs *flag.FlagSet, args []string, cfg *config, file *string) (map[string]bool, error) {
+	parse := func() error {
+		var err error
+		fs.VisitAll(func(f *flag.Flag) {
+			if v, ok := os.LookupEnv(envName(f.Name)); ok && err == nil {
+				if e := fs.Set(f.Name, v); e != nil {
+					err = fmt.Errorf("%s: %v", envName(f.Name), e)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return fs.Parse(args)
+	}
+	if err := parse(); err != nil {
+		return nil, err
+	}
+	if *file != "" {
+		if err := cfg.load(*file); err != nil {
+			return nil, fmt.Errorf("%s: %v", *file, err)
+		}
+		// The file was read over the flags, so they are set again
+		if err := parse(); err != nil {
+			return nil, err
+		}
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set, nil
+}
+
+// parseDevices reads a list of slave ids, each optionally named, like "1=house,2=shed"
+func parseDevices(list string) ([]deviceConfig, error) {
+	var devices []deviceConfig
+	for _, entry := range strings.Split(list, ",") {
+		idName := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		id, err := strconv.Atoi(idName[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad slave id %q, want 1-247", idName[0])
+		}
+		d := deviceConfig{SlaveID: id}
+		if len(idName) == 2 {
+			d.Name = idName[1]
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// parsePollIntervals reads a list like "realtime=5s,config=0" into the poll
+// intervals, leaving the groups not listed alone
+func parsePollIntervals(poll map[string]duration, list string) error {
+	for _, entry := range strings.Split(list, ",") {
+		nameInterval := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(nameInterval) != 2 {
+			return fmt.Errorf("bad poll interval %q, want group=duration", entry)
+		}
+		var d duration
+		if err := d.Set(nameInterval[1]); err != nil {
+			return fmt.Errorf("bad poll interval %q: %v", entry, err)
+		}
+		poll[nameInterval[0]] = d
+	}
+	return nil
+}
+
+// intervals returns the poll intervals by group
+func (c config) intervals() epever.PollIntervals {
+	intervals := epever.PollIntervals{}
+	for _, g := range epever.PollGroups {
+		if d := c.Poll[g.String()]; d > 0 {
+			intervals[g] = time.Duration(d)
+		}
+	}
+	return intervals
+}
+
+// staleAfter is the age at which a controller's values stop being exported
+func (c config) staleAfter() time.Duration {
+	return time.Duration(c.Exporters.Prometheus.StalePolls) * c.intervals()[epever.RealtimeGroup]
+}
+
+// validate checks the whole config, listing every problem found
+func (c config) validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		add("timezone %q: %v", c.Timezone, err)
+	}
+	if c.UpdatePeriod <= 0 {
+		add("update_period %v must be positive", c.UpdatePeriod)
+	}
+	if c.SyncRTC < 0 {
+		add("sync_rtc %v must not be negative", c.SyncRTC)
+	}
+
+	if len(c.Ports) == 0 {
+		add("ports: none given")
+	}
+	addresses := map[string]bool{}
+	for i, p := range c.Ports {
+		where := fmt.Sprintf("ports[%d]", i)
+		if _, err := epever.NewTransport(p.address()); err != nil {
+			add("%s: %v", where, err)
+		}
+		if addresses[p.Address] {
+			add("%s: address %q is listed twice", where, p.Address)
+		}
+		addresses[p.Address] = true
+		if p.Baud < 0 {
+			add("%s: baud %d must be positive", where, p.Baud)
+		} else if p.Baud > 0 && !strings.HasPrefix(p.address(), "rtu://") {
+			add("%s: baud is only for serial ports", where)
+		}
+		if p.Timeout < 0 {
+			add("%s: timeout %v must be positive", where, p.Timeout)
+		}
+		if len(p.Devices) == 0 {
+			add("%s: no devices", where)
+		}
+		ids := map[int]bool{}
+		for j, d := range p.Devices {
+			if d.SlaveID < 1 || d.SlaveID > 247 {
+				add("%s.devices[%d]: slave_id %d, want 1-247", where, j, d.SlaveID)
+			} else if ids[d.SlaveID] {
+				add("%s.devices[%d]: slave_id %d is listed twice", where, j, d.SlaveID)
+			}
+			ids[d.SlaveID] = true
+		}
+	}
+
+	if c.Site.Panels < 0 || c.Site.MaxPowerWatts < 0 || c.Site.Batteries < 0 {
+		add("site: panels, max_power_watts and batteries must not be negative")
+	}
+
+	groups := map[string]bool{}
+	for _, g := range epever.PollGroups {
+		groups[g.String()] = true
+	}
+	for name, d := range c.Poll {
+		if !groups[name] {
+			add("poll: unknown group %q, want realtime, status, stats, rtc or config", name)
+		} else if d < 0 {
+			add("poll: %s interval %v must not be negative", name, d)
+		}
+	}
+
+	prom := c.Exporters.Prometheus
+	if prom.Listen != "" {
+		if _, _, err := net.SplitHostPort(prom.Listen); err != nil {
+			add("exporters.prometheus.listen %q: want host:port or :port", prom.Listen)
+		}
+	}
+	if prom.StalePolls < 0 {
+		add("exporters.prometheus.stale_polls %d must not be negative", prom.StalePolls)
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// address is the port's address with its baud and timeout added
+func (p portConfig) address() string {
+	if p.Baud == 0 && p.Timeout == 0 {
+		return p.Address
+	}
+	address := p.Address
+	if strings.HasPrefix(address, "/") {
+		address = "rtu://" + address
+	}
+	q := url.Values{}
+	if p.Baud != 0 {
+		q.Set("baud", strconv.Itoa(p.Baud))
+	}
+	if p.Timeout != 0 {
+		q.Set("timeout", p.Timeout.String())
+	}
+	separator := "?"
+	if strings.Contains(address, "?") {
+		separator = "&"
+	}
+	return address + separator + q.Encode()
+}
+
+// controllers creates a bus for each port and a controller for each device on it
+func (c config) controllers() ([]*epever.Epever, error) {
+	var eps []*epever.Epever
+	for _, p := range c.Ports {
+		bus, err := epever.NewBus(p.address())
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range p.Devices {
+			eps = append(eps, epever.NewEpeverOnBus(bus, byte(d.SlaveID), d.Name))
+		}
+	}
+	return eps, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"solar/epever"
+)
+
+const yamlConfig = `
+timezone: Pacific/Auckland
+ports:
+  - address: /dev/ttyUSB0
+    baud: 9600
+    devices:
+      - slave_id: 1
+        name: house
+      - slave_id: 2
+        name: shed
+  - address: tcp://gateway:502
+    timeout: 2s
+    devices:
+      - slave_id: 3
+site:
+  panels: 8
+  max_power_watts: 2400
+  batteries: 2
+poll:
+  realtime: 10s
+  config: 0
+exporters:
+  prometheus:
+    listen: 127.0.0.1:9100
+    stale_polls: 5
+`
+
+const tomlConfig = `
+timezone = "Pacific/Auckland"
+
+[[ports]]
+address = "/dev/ttyUSB0"
+baud = 9600
+devices = [{slave_id = 1, name = "house"}, {slave_id = 2, name = "shed"}]
+
+[[ports]]
+address = "tcp://gateway:502"
+timeout = "2s"
+devices = [{slave_id = 3}]
+
+[site]
+panels = 8
+max_power_watts = 2400
+batteries = 2
+
+[poll]
+realtime = "10s"
+config = 0
+
+[exporters.prometheus]
+listen = "127.0.0.1:9100"
+stale_polls = 5
+`
+
+// writeConfig writes a config file in a temporary directory
+func writeConfig(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, tc := range []struct{ name, content string }{
+		{"solar.yaml", yamlConfig},
+		{"solar.toml", tomlConfig},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			if err := cfg.load(writeConfig(t, tc.name, tc.content)); err != nil {
+				t.Fatal(err)
+			}
+			if err := cfg.validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			ports := []portConfig{
+				{Address: "/dev/ttyUSB0", Baud: 9600, Devices: []deviceConfig{{1, "house"}, {2, "shed"}}},
+				{Address: "tcp://gateway:502", Timeout: duration(2 * time.Second), Devices: []deviceConfig{{SlaveID: 3}}},
+			}
+			if !reflect.DeepEqual(cfg.Ports, ports) {
+				t.Errorf("ports %+v, want %+v", cfg.Ports, ports)
+			}
+			if got := cfg.Ports[0].address(); got != "rtu:///dev/ttyUSB0?baud=9600" {
+				t.Errorf("serial address %q", got)
+			}
+			if got := cfg.Ports[1].address(); got != "tcp://gateway:502?timeout=2s" {
+				t.Errorf("tcp address %q", got)
+			}
+			if cfg.Site != (siteConfig{Panels: 8, MaxPowerWatts: 2400, Batteries: 2}) {
+				t.Errorf("site %+v", cfg.Site)
+			}
+
+			// Groups not in the file keep their default interval
+			intervals := cfg.intervals()
+			want := epever.PollIntervals{
+				epever.RealtimeGroup: 10 * time.Second,
+				epever.StatusGroup:   epever.DefaultPollIntervals[epever.StatusGroup],
+				epever.StatsGroup:    epever.DefaultPollIntervals[epever.StatsGroup],
+				epever.RTCGroup:      epever.DefaultPollIntervals[epever.RTCGroup],
+			}
+			if !reflect.DeepEqual(intervals, want) {
+				t.Errorf("intervals %v, want %v", intervals, want)
+			}
+			if got := cfg.staleAfter(); got != 50*time.Second {
+				t.Errorf("stale after %v, want 50s", got)
+			}
+			if !cfg.Exporters.Console.Enabled || cfg.Exporters.Prometheus.Listen != "127.0.0.1:9100" {
+				t.Errorf("exporters %+v", cfg.Exporters)
+			}
+		})
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	cfg := defaultConfig()
+	if err := cfg.load(writeConfig(t, "solar.yaml", "site:\n  panel: 6\n")); err == nil || !strings.Contains(err.Error(), "panel") {
+		t.Errorf("misspelt yaml setting gave %v", err)
+	}
+	if err := cfg.load(writeConfig(t, "solar.toml", "[site]\npanel = 6\n")); err == nil || !strings.Contains(err.Error(), "site.panel") {
+		t.Errorf("misspelt toml setting gave %v", err)
+	}
+	if err := cfg.load(writeConfig(t, "solar.ini", "")); err == nil {
+		t.Errorf("ini file loaded")
+	}
+
+	cfg = defaultConfig()
+	cfg.Timezone = "Mars/Olympus"
+	cfg.Ports = []portConfig{
+		{Address: "tcp://gateway:502", Baud: 9600, Devices: []deviceConfig{{SlaveID: 1}, {SlaveID: 1}}},
+		{Address: "serial://x", Devices: []deviceConfig{{SlaveID: 300}}},
+		{Address: "/dev/ttyUSB0"},
+	}
+	cfg.Poll["fast"] = duration(time.Second)
+	cfg.Exporters.Prometheus.Listen = "2112"
+	err := cfg.validate()
+	if err == nil {
+		t.Fatal("invalid config passed")
+	}
+	for _, want := range []string{
+		"timezone",
+		"ports[0]: baud is only for serial ports",
+		"ports[0].devices[1]: slave_id 1 is listed twice",
+		"ports[1]: epever: unknown scheme",
+		"ports[1].devices[0]: slave_id 300, want 1-247",
+		"ports[2]: no devices",
+		`poll: unknown group "fast"`,
+		"exporters.prometheus.listen",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error doesn't mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestParseConfigPrecedence(t *testing.T) {
+	file := writeConfig(t, "solar.yaml", "timezone: Pacific/Auckland\nenforce: true\nexporters:\n  prometheus:\n    stale_polls: 5\n    listen: :9100\n")
+	os.Setenv("SOLAR_STALE_POLLS", "7")
+	os.Setenv("SOLAR_LISTEN", ":9200")
+	defer os.Unsetenv("SOLAR_STALE_POLLS")
+	defer os.Unsetenv("SOLAR_LISTEN")
+
+	cfg := defaultConfig()
+	fs := flag.NewFlagSet("solar", flag.ContinueOnError)
+	configFile := fs.String("config", "", "")
+	fs.StringVar(&cfg.Timezone, "timezone", cfg.Timezone, "")
+	fs.BoolVar(&cfg.Enforce, "enforce", cfg.Enforce, "")
+	fs.StringVar(&cfg.Exporters.Prometheus.Listen, "listen", cfg.Exporters.Prometheus.Listen, "")
+	fs.IntVar(&cfg.Exporters.Prometheus.StalePolls, "stale-polls", cfg.Exporters.Prometheus.StalePolls, "")
+
+	set, err := parseConfig(fs, []string{"-config", file, "-listen", ":9300", "monitor"}, &cfg, configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Timezone != "Pacific/Auckland" || !cfg.Enforce {
+		t.Errorf("file not read: timezone %s enforce %v", cfg.Timezone, cfg.Enforce)
+	}
+	if cfg.Exporters.Prometheus.StalePolls != 7 {
+		t.Errorf("stale polls %d, want 7 from the environment over the file", cfg.Exporters.Prometheus.StalePolls)
+	}
+	if cfg.Exporters.Prometheus.Listen != ":9300" {
+		t.Errorf("listen %s, want :9300 from the flag over the environment", cfg.Exporters.Prometheus.Listen)
+	}
+	if !set["listen"] || !set["stale-polls"] || set["timezone"] || fs.Arg(0) != "monitor" {
+		t.Errorf("flags set %v, args %v", set, fs.Args())
+	}
+
+	os.Setenv("SOLAR_STALE_POLLS", "many")
+	if _, err := parseConfig(fs, nil, &cfg, configFile); err == nil || !strings.Contains(err.Error(), "SOLAR_STALE_POLLS") {
+		t.Errorf("bad environment variable gave %v", err)
+	}
+}
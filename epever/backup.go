@@ -0,0 +1,262 @@
+package epever
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BackupVersion is the version of the backup file format written by this package
+const BackupVersion = 1
+
+// Backup holds every writable holding register of a controller so the
+// settings can be restored onto it, or onto a replacement, later
+type Backup struct {
+	Version   int              `json:"version" yaml:"version"`
+	Model     string           `json:"model" yaml:"model"`
+	Device    string           `json:"device" yaml:"device"`
+	SlaveID   byte             `json:"slave_id" yaml:"slave_id"`
+	Taken     time.Time        `json:"taken" yaml:"taken"`
+	Registers []BackupRegister `json:"registers" yaml:"registers"`
+}
+
+// BackupRegister is one holding register. Only Address and Raw are restored,
+// Name and Value are there for people reading the file.
+type BackupRegister struct {
+	Address uint16 `json:"address" yaml:"address"`
+	Name    string `json:"name" yaml:"name"`
+	Raw     uint16 `json:"raw" yaml:"raw"`
+	Value   string `json:"value" yaml:"value"`
+}
+
+// RegisterChange is a holding register a restore would change
+type RegisterChange struct {
+	Address  uint16
+	Name     string
+	From, To uint16
+}
+
+func (c RegisterChange) String() string {
+	return fmt.Sprintf("0x%04x %s %d -> %d", c.Address, c.Name, c.From, c.To)
+}
+
+// backupBlocks is the read plan for a backup: every holding register in the
+// map except the clock, which is never restored
+var backupBlocks = planBlocks(backupRegisters())
+
+func backupRegisters() []Register {
+	var regs []Register
+	for _, r := range Registers {
+		if r.Table == HoldingRegister && (r.Address < REGRTCSecMin || r.Address > REGRTCMonthYear) {
+			regs = append(regs, r)
+		}
+	}
+	return regs
+}
+
+// Marshal writes the backup as "json" or "yaml"
+func (b Backup) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.MarshalIndent(b, "", "  ")
+	case "yaml", "yml":
+		return yaml.Marshal(b)
+	}
+	return nil, fmt.Errorf("unknown backup format %q, want json or yaml", format)
+}
+
+// UnmarshalBackup reads a backup written by Marshal
+func UnmarshalBackup(data []byte, format string) (Backup, error) {
+	var b Backup
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, &b)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &b)
+	default:
+		err = fmt.Errorf("unknown backup format %q, want json or yaml", format)
+	}
+	if err != nil {
+		return Backup{}, err
+	}
+	if b.Version < 1 || b.Version > BackupVersion {
+		return Backup{}, fmt.Errorf("backup version %d not supported, want 1-%d", b.Version, BackupVersion)
+	}
+	return b, nil
+}
+
+// ratedBlock is read for the model in a backup
+var ratedBlock = planBlocks(registersIn(InputRegister, REGRatedBatteryVoltage, REGRatedBatteryCurrent))[0]
+
+// Model describes the controller from its ratings, as the register map has
+// no model number
+func (s Snapshot) Model() string {
+	return fmt.Sprintf("Epever %.0fV %.0fA", s.RatedBatteryVoltage, s.RatedBatteryCurrent)
+}
+
+// Backup reads every writable holding register
+func (e *Epever) Backup(ctx context.Context) (Backup, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	words, err := e.readBackupRegisters(ctx)
+	if err != nil {
+		return Backup{}, err
+	}
+	rated := ratedBlock
+	data, err := e.readTable(ctx, rated.table, rated.address, rated.quantity)
+	if err != nil {
+		return Backup{}, err
+	}
+	var s Snapshot
+	rated.decode(&s, data)
+
+	backup := Backup{
+		Version: BackupVersion,
+		Model:   s.Model(),
+		Device:  e.bus.String(),
+		SlaveID: e.slaveID,
+		Taken:   time.Now().UTC().Truncate(time.Second),
+	}
+	for _, b := range backupBlocks {
+		for a := b.address; a < b.address+b.quantity; a++ {
+			backup.Registers = append(backup.Registers, backupRegister(a, words[a]))
+		}
+	}
+	return backup, nil
+}
+
+// backupRegister describes one register value for the file
+func backupRegister(address, raw uint16) BackupRegister {
+	var names, values []string
+	for _, r := range Registers {
+		if r.Table == HoldingRegister && r.Address == address {
+			names = append(names, r.Name)
+			values = append(values, strconv.FormatFloat(r.decode(uint32(raw)), 'f', -1, 64))
+		}
+	}
+	return BackupRegister{Address: address, Name: strings.Join(names, ","), Raw: raw, Value: strings.Join(values, ",")}
+}
+
+// readBackupRegisters reads the backup blocks into a map of address to
+// contents. Caller must hold the bus mutex.
+func (e *Epever) readBackupRegisters(ctx context.Context) (map[uint16]uint16, error) {
+	words := map[uint16]uint16{}
+	for _, b := range backupBlocks {
+		data, err := e.readTable(ctx, b.table, b.address, b.quantity)
+		if err != nil {
+			return nil, err
+		}
+		b.decode(&e.snapshot, data)
+		for i := uint16(0); i < b.quantity; i++ {
+			words[b.address+i] = binary.BigEndian.Uint16(data[2*i:])
+		}
+	}
+	return words, nil
+}
+
+// DiffBackup reads the controller and returns the registers restoring the
+// backup would change
+func (e *Epever) DiffBackup(ctx context.Context, backup Backup) ([]RegisterChange, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	words, err := e.readBackupRegisters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return diffBackup(backup, words)
+}
+
+func diffBackup(backup Backup, words map[uint16]uint16) ([]RegisterChange, error) {
+	var changes []RegisterChange
+	for _, r := range backup.Registers {
+		current, ok := words[r.Address]
+		if !ok {
+			return nil, fmt.Errorf("%w: backup has register 0x%04x which isn't restorable", ErrInvalidConfig, r.Address)
+		}
+		if current != r.Raw {
+			changes = append(changes, RegisterChange{Address: r.Address, Name: backupRegister(r.Address, 0).Name, From: current, To: r.Raw})
+		}
+	}
+	return changes, nil
+}
+
+// Restore writes the registers of the backup that differ from the controller
+// and reads them back to check they took, rolling them all back if any didn't. The battery settings 9000-900e are
+// written as a whole block if any of them changed, as the controller requires,
+// and are validated first. The changes made are returned.
+func (e *Epever) Restore(ctx context.Context, backup Backup) ([]RegisterChange, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	words, err := e.readBackupRegisters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := diffBackup(backup, words)
+	if err != nil || len(changes) == 0 {
+		return nil, err
+	}
+
+	// The wanted contents of every register, changed or not
+	want := map[uint16]uint16{}
+	for a, v := range words {
+		want[a] = v
+	}
+	changed := map[uint16]bool{}
+	for _, c := range changes {
+		want[c.Address] = c.To
+		changed[c.Address] = true
+	}
+
+	battery := batteryConfigBlock
+	for a := battery.address; a < battery.address+battery.quantity; a++ {
+		if changed[a] {
+			var s Snapshot
+			battery.decodeWords(&s, wordsRun(want, battery.address, battery.quantity))
+			if err := s.BatteryConfig().Validate(); err != nil {
+				return nil, err
+			}
+			for a := battery.address; a < battery.address+battery.quantity; a++ {
+				changed[a] = true
+			}
+			break
+		}
+	}
+
+	// Write each run of changed registers in one request
+	var writes []regWrite
+	for _, b := range backupBlocks {
+		for a := b.address; a < b.address+b.quantity; a++ {
+			if !changed[a] {
+				continue
+			}
+			start := a
+			for a < b.address+b.quantity && changed[a] {
+				a++
+			}
+			writes = append(writes, regWrite{table: HoldingRegister, address: start, words: wordsRun(want, start, a-start)})
+		}
+	}
+	if err := e.commit(ctx, writes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// wordsRun picks a run of register contents out of a map of them
+func wordsRun(words map[uint16]uint16, address, quantity uint16) []uint16 {
+	run := make([]uint16, quantity)
+	for i := range run {
+		run[i] = words[address+uint16(i)]
+	}
+	return run
+}
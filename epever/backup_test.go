@@ -0,0 +1,70 @@
+package epever
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	slave := newFakeSlave(1)
+	slave.input[REGRatedBatteryVoltage] = 2400
+	slave.input[REGRatedBatteryCurrent] = 4000
+	for _, b := range backupBlocks {
+		for a := b.address; a < b.address+b.quantity; a++ {
+			slave.holding[a] = 0
+		}
+	}
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	ctx := context.Background()
+
+	if err := ep.SetBatteryConfig(ctx, testBatteryConfig); err != nil {
+		t.Fatal(err)
+	}
+	slave.holding[REGLoadWorkingTime1] = 4<<8 | 30
+	backup, err := ep.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.Model != "Epever 24V 40A" || backup.SlaveID != 1 {
+		t.Errorf("backup is of %q slave %d", backup.Model, backup.SlaveID)
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		data, err := backup.Marshal(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := UnmarshalBackup(data, format)
+		if err != nil || len(loaded.Registers) != len(backup.Registers) || !loaded.Taken.Equal(backup.Taken) {
+			t.Errorf("%s: backup loads as %+v, %v", format, loaded, err)
+		}
+	}
+
+	// A swapped controller with one timer and one battery setting different
+	slave.holding[REGLoadWorkingTime1] = 0
+	slave.holding[REGBatteryBoostChargingVoltage] = 2900
+	changes, err := ep.DiffBackup(ctx, backup)
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("diff is %v, %v", changes, err)
+	}
+
+	requests := slave.requests
+	if _, err := ep.Restore(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+	if slave.holding[REGLoadWorkingTime1] != 4<<8|30 || slave.holding[REGBatteryBoostChargingVoltage] != 2880 {
+		t.Errorf("registers not restored")
+	}
+	// One read of the backup blocks, then a read of the old contents, a write
+	// and a read back for each of the working time and the battery block
+	if got, want := slave.requests-requests, len(backupBlocks)+6; got != want {
+		t.Errorf("restore made %d requests, want %d", got, want)
+	}
+	if changes, err := ep.DiffBackup(ctx, backup); err != nil || len(changes) != 0 {
+		t.Errorf("diff after restore is %v, %v", changes, err)
+	}
+}
@@ -0,0 +1,156 @@
+package epever
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidConfig is matched by errors.Is when settings are refused before anything is written
+var ErrInvalidConfig = errors.New("epever: invalid configuration")
+
+// BatteryConfig is the battery settings block 9000-900e. The controller only
+// accepts it written as a whole, and only takes the voltages when the battery
+// type is user (0).
+type BatteryConfig struct {
+	BatteryType uint16 // 0 user, 1 sealed, 2 gel, 3 flooded
+	Capacity    uint16 // Ah
+	TempCoef    float64
+
+	OverVoltDisconnect                float64
+	ChargingLimitVoltage              float64
+	OverVoltageReconnect              float64
+	EqualizeChargingVoltage           float64
+	BoostChargingVoltage              float64
+	FloatChargingVoltage              float64
+	BoostReconnectChargingVoltage     float64
+	LowVoltageReconnectVoltage        float64
+	UnderVoltageWarningRecoverVoltage float64
+	UnderVoltageWarningVoltage        float64
+	LowVoltageDisconnectVoltage       float64
+	DischargingLimitVoltage           float64
+}
+
+// BatteryConfig returns the battery settings read into the snapshot
+func (s Snapshot) BatteryConfig() BatteryConfig {
+	return BatteryConfig{
+		BatteryType:                       s.BatteryConfigBatteryType,
+		Capacity:                          s.BatteryConfigCapacity,
+		TempCoef:                          s.BatteryConfigTempCoef,
+		OverVoltDisconnect:                s.BatteryConfigOverVoltDisconnect,
+		ChargingLimitVoltage:              s.BatteryConfigChargingLimitVoltage,
+		OverVoltageReconnect:              s.BatteryConfigOverVoltageReconnect,
+		EqualizeChargingVoltage:           s.BatteryConfigEqualizeChargingVoltage,
+		BoostChargingVoltage:              s.BatteryConfigBoostChargingVoltage,
+		FloatChargingVoltage:              s.BatteryConfigFloatChargingVoltage,
+		BoostReconnectChargingVoltage:     s.BatteryConfigBoostReconnectChargingVoltage,
+		LowVoltageReconnectVoltage:        s.BatteryConfigLowVoltageReconnectVoltage,
+		UnderVoltageWarningRecoverVoltage: s.BatteryConfigUnderVoltageWarningRecoverVoltage,
+		UnderVoltageWarningVoltage:        s.BatteryConfigUnderVoltageWarningVoltage,
+		LowVoltageDisconnectVoltage:       s.BatteryConfigLowVoltageDisconnectVoltage,
+		DischargingLimitVoltage:           s.BatteryConfigDischargingLimitVoltage,
+	}
+}
+
+// apply copies the settings into the snapshot fields they are encoded from
+func (c BatteryConfig) apply(s *Snapshot) {
+	s.BatteryConfigBatteryType = c.BatteryType
+	s.BatteryConfigCapacity = c.Capacity
+	s.BatteryConfigTempCoef = c.TempCoef
+	s.BatteryConfigOverVoltDisconnect = c.OverVoltDisconnect
+	s.BatteryConfigChargingLimitVoltage = c.ChargingLimitVoltage
+	s.BatteryConfigOverVoltageReconnect = c.OverVoltageReconnect
+	s.BatteryConfigEqualizeChargingVoltage = c.EqualizeChargingVoltage
+	s.BatteryConfigBoostChargingVoltage = c.BoostChargingVoltage
+	s.BatteryConfigFloatChargingVoltage = c.FloatChargingVoltage
+	s.BatteryConfigBoostReconnectChargingVoltage = c.BoostReconnectChargingVoltage
+	s.BatteryConfigLowVoltageReconnectVoltage = c.LowVoltageReconnectVoltage
+	s.BatteryConfigUnderVoltageWarningRecoverVoltage = c.UnderVoltageWarningRecoverVoltage
+	s.BatteryConfigUnderVoltageWarningVoltage = c.UnderVoltageWarningVoltage
+	s.BatteryConfigLowVoltageDisconnectVoltage = c.LowVoltageDisconnectVoltage
+	s.BatteryConfigDischargingLimitVoltage = c.DischargingLimitVoltage
+}
+
+// Set changes one setting by field name, ignoring case, eg Set("boostchargingvoltage", "28.8")
+func (c *BatteryConfig) Set(name, value string) error {
+	return setField(c, name, value)
+}
+
+// Validate checks the settings against the controller's own rules, reporting
+// every problem found. The voltages must keep this order:
+//
+//	OverVoltDisconnect > ChargingLimit >= Equalize >= Boost >= Float > BoostReconnect
+//	OverVoltDisconnect > OverVoltageReconnect
+//	LowVoltageReconnect > LowVoltageDisconnect >= DischargingLimit
+//	UnderVoltageWarningRecover > UnderVoltageWarning >= DischargingLimit
+//	BoostReconnect > LowVoltageReconnect
+func (c BatteryConfig) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	greater := func(a string, av float64, b string, bv float64) {
+		check(av > bv, "%s %.2fV must be above %s %.2fV", a, av, b, bv)
+	}
+	atLeast := func(a string, av float64, b string, bv float64) {
+		check(av >= bv, "%s %.2fV must not be below %s %.2fV", a, av, b, bv)
+	}
+
+	check(c.BatteryType <= 3, "battery type %d must be 0-3", c.BatteryType)
+	check(c.Capacity >= 1 && c.Capacity <= 9999, "capacity %dAh must be 1-9999", c.Capacity)
+	check(c.TempCoef >= 0 && c.TempCoef <= 9, "temperature coefficient %.2f must be 0-9", c.TempCoef)
+
+	greater("over voltage disconnect", c.OverVoltDisconnect, "charging limit", c.ChargingLimitVoltage)
+	atLeast("charging limit", c.ChargingLimitVoltage, "equalize", c.EqualizeChargingVoltage)
+	atLeast("equalize", c.EqualizeChargingVoltage, "boost", c.BoostChargingVoltage)
+	atLeast("boost", c.BoostChargingVoltage, "float", c.FloatChargingVoltage)
+	greater("float", c.FloatChargingVoltage, "boost reconnect", c.BoostReconnectChargingVoltage)
+	greater("over voltage disconnect", c.OverVoltDisconnect, "over voltage reconnect", c.OverVoltageReconnect)
+
+	greater("low voltage reconnect", c.LowVoltageReconnectVoltage, "low voltage disconnect", c.LowVoltageDisconnectVoltage)
+	atLeast("low voltage disconnect", c.LowVoltageDisconnectVoltage, "discharging limit", c.DischargingLimitVoltage)
+	greater("under voltage warning recover", c.UnderVoltageWarningRecoverVoltage, "under voltage warning", c.UnderVoltageWarningVoltage)
+	atLeast("under voltage warning", c.UnderVoltageWarningVoltage, "discharging limit", c.DischargingLimitVoltage)
+	greater("boost reconnect", c.BoostReconnectChargingVoltage, "low voltage reconnect", c.LowVoltageReconnectVoltage)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// batteryConfigBlock is the write plan for the battery settings, a single block
+var batteryConfigBlock = planBlocks(registersIn(HoldingRegister, REGBatteryType, REGBatteryDischargingLimitVoltage))[0]
+
+// ReadBatteryConfig reads the battery settings block
+func (e *Epever) ReadBatteryConfig(ctx context.Context) (BatteryConfig, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	b := batteryConfigBlock
+	data, err := e.readTable(ctx, b.table, b.address, b.quantity)
+	if err != nil {
+		return BatteryConfig{}, err
+	}
+	b.decode(&e.snapshot, data)
+	return e.snapshot.BatteryConfig(), nil
+}
+
+// SetBatteryConfig validates the settings, writes the whole block in one
+// request and reads it back to check the controller took every value. The
+// block is rolled back if it didn't.
+func (e *Epever) SetBatteryConfig(ctx context.Context, c BatteryConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	var s Snapshot
+	c.apply(&s)
+	return e.commit(ctx, []regWrite{blockWrite(batteryConfigBlock, s)})
+}
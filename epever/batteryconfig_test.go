@@ -0,0 +1,88 @@
+package epever
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// The 24V lead acid settings from the sample output in the README
+var testBatteryConfig = BatteryConfig{
+	BatteryType:                       0,
+	Capacity:                          200,
+	TempCoef:                          3,
+	OverVoltDisconnect:                32,
+	ChargingLimitVoltage:              30,
+	OverVoltageReconnect:              30,
+	EqualizeChargingVoltage:           29.2,
+	BoostChargingVoltage:              28.8,
+	FloatChargingVoltage:              27.6,
+	BoostReconnectChargingVoltage:     26.4,
+	LowVoltageReconnectVoltage:        25.2,
+	UnderVoltageWarningRecoverVoltage: 24.4,
+	UnderVoltageWarningVoltage:        24,
+	LowVoltageDisconnectVoltage:       22.2,
+	DischargingLimitVoltage:           21.2,
+}
+
+func TestBatteryConfigValidate(t *testing.T) {
+	if err := testBatteryConfig.Validate(); err != nil {
+		t.Fatalf("sample settings refused: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		change func(c *BatteryConfig)
+		want   string
+	}{
+		{"float above boost", func(c *BatteryConfig) { c.FloatChargingVoltage = 29 }, "boost 28.80V must not be below float 29.00V"},
+		{"boost reconnect equals float", func(c *BatteryConfig) { c.BoostReconnectChargingVoltage = 27.6 }, "float 27.60V must be above boost reconnect 27.60V"},
+		{"charging limit at disconnect", func(c *BatteryConfig) { c.ChargingLimitVoltage = 32 }, "over voltage disconnect 32.00V must be above charging limit 32.00V"},
+		{"disconnect below limit", func(c *BatteryConfig) { c.LowVoltageDisconnectVoltage = 21 }, "low voltage disconnect 21.00V must not be below discharging limit 21.20V"},
+		{"warning recover below warning", func(c *BatteryConfig) { c.UnderVoltageWarningRecoverVoltage = 23.9 }, "under voltage warning recover 23.90V must be above under voltage warning 24.00V"},
+		{"battery type", func(c *BatteryConfig) { c.BatteryType = 4 }, "battery type 4 must be 0-3"},
+	} {
+		c := testBatteryConfig
+		tc.change(&c)
+		err := c.Validate()
+		if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestSetBatteryConfig(t *testing.T) {
+	slave := newFakeSlave(1)
+	for a := uint16(REGBatteryType); a <= REGBatteryDischargingLimitVoltage; a++ {
+		slave.holding[a] = 0
+	}
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	ctx := context.Background()
+
+	if err := ep.SetBatteryConfig(ctx, testBatteryConfig); err != nil {
+		t.Fatal(err)
+	}
+	if got := slave.holding[REGBatteryFloatChargingVoltage]; got != 2760 {
+		t.Errorf("float register holds %d, want 2760", got)
+	}
+	got, err := ep.ReadBatteryConfig(ctx)
+	if err != nil || got != testBatteryConfig {
+		t.Errorf("read back %+v, %v", got, err)
+	}
+
+	// Nothing reaches the controller when the settings are refused
+	requests := slave.requests
+	bad := testBatteryConfig
+	bad.FloatChargingVoltage = 29
+	if err := ep.SetBatteryConfig(ctx, bad); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected the settings to be refused, got %v", err)
+	}
+	if slave.requests != requests {
+		t.Errorf("refused settings were sent to the controller")
+	}
+}
@@ -0,0 +1,103 @@
+package epever
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Bus is one transport shared by every controller on the same line, eg
+// several Tracers daisy chained on one RS-485 port. Only one controller
+// talks at a time so frames never interleave on the wire.
+type Bus struct {
+	mu         sync.Mutex
+	transport  Transport
+	connected  bool
+	connects   int  // Successful connects, so those after the first are reconnects
+	lost       bool // Disconnected since the last connect, so the next one is a reconnect
+	reconnects int  // Connects that reopened the transport after a disconnect
+}
+
+// Create a new Bus using the given address, see NewTransport for the accepted forms
+func NewBus(address string) (*Bus, error) {
+	transport, err := NewTransport(address)
+	if err != nil {
+		return nil, err
+	}
+	return NewBusTransport(transport), nil
+}
+
+// Create a new Bus using an existing transport
+func NewBusTransport(transport Transport) *Bus {
+	return &Bus{transport: transport}
+}
+
+// Show the bus address
+func (b *Bus) String() string {
+	return b.transport.String()
+}
+
+// Connect opens the transport, closing any existing connection first
+func (b *Bus) Connect(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.connected {
+		b.disconnect()
+	}
+	_, err := b.connect(ctx)
+	return err
+}
+
+// Close the connection if there is one
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.disconnect()
+}
+
+// connect opens the transport if needed, saying whether it did. Caller must
+// hold the mutex.
+func (b *Bus) connect(ctx context.Context) (bool, error) {
+	if b.connected {
+		return false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if err := b.transport.Connect(); err != nil {
+		return false, err
+	}
+	b.connected = true
+	b.connects++
+	if b.lost {
+		b.lost = false
+		b.reconnects++
+	}
+	fmt.Printf("Connected to epever on %s\n", b.transport)
+	return true, nil
+}
+
+// reconnectCount is how many times the bus has reopened after a disconnect.
+// Closing the transport to resync after a timeout or bad frame is not one.
+func (b *Bus) reconnectCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reconnects
+}
+
+// disconnect closes the transport because the connection was lost or closed
+// on purpose, so the next connect is a reconnect. Caller must hold the mutex.
+func (b *Bus) disconnect() error {
+	b.lost = true
+	return b.close()
+}
+
+// close the transport. Caller must hold the mutex.
+func (b *Bus) close() error {
+	if !b.connected {
+		return nil
+	}
+	fmt.Printf("Closing existing connection.\n")
+	b.connected = false
+	return b.transport.Close()
+}
@@ -0,0 +1,62 @@
+package epever
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestSharedBus(t *testing.T) {
+	house, shed := newFakeSlave(1), newFakeSlave(2)
+	for _, f := range []*fakeSlave{house, shed} {
+		f.fill(refreshBlocks)
+		f.baud = 115200
+	}
+	house.input[REGBatteryVoltage] = 2650
+	shed.input[REGBatteryVoltage] = 1280
+	gateway := newFakeBus(house, shed)
+
+	bus, err := NewBus("tcp://" + gateway.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	eps := []*Epever{NewEpeverOnBus(bus, 1, "house"), NewEpeverOnBus(bus, 2, "shed")}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*3)
+	for _, ep := range eps {
+		wg.Add(1)
+		go func(ep *Epever) {
+			defer wg.Done()
+			for i := 0; i < 3; i++ {
+				if _, err := ep.Refresh(context.Background()); err != nil {
+					errs <- err
+				}
+			}
+		}(ep)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for i, want := range []float64{26.5, 12.8} {
+		if got := eps[i].Snapshot().BatteryVoltage; got != want {
+			t.Errorf("%s battery %v, want %v", eps[i].Name(), got, want)
+		}
+	}
+	gateway.mu.Lock()
+	defer gateway.mu.Unlock()
+	if gateway.overlaps != 0 {
+		t.Errorf("%d requests overlapped on the bus", gateway.overlaps)
+	}
+	house.mu.Lock()
+	defer house.mu.Unlock()
+	shed.mu.Lock()
+	defer shed.mu.Unlock()
+	if house.requests != shed.requests || house.requests != 3*len(refreshBlocks) {
+		t.Errorf("house answered %d requests and shed %d, want %d each", house.requests, shed.requests, 3*len(refreshBlocks))
+	}
+}
@@ -0,0 +1,56 @@
+package epever
+
+import (
+	"context"
+	"strings"
+)
+
+// LookupRegister finds an entry of the register map by its Snapshot field
+// name, ignoring case
+func LookupRegister(name string) (Register, bool) {
+	for _, r := range Registers {
+		if strings.EqualFold(r.Name, name) {
+			return r, true
+		}
+	}
+	return Register{}, false
+}
+
+// CoilRegisters returns the coil entries of the register map, in map order
+func CoilRegisters() []Register {
+	var coils []Register
+	for _, r := range Registers {
+		if r.Table == Coil {
+			coils = append(coils, r)
+		}
+	}
+	return coils
+}
+
+// ReadCoil reads the current state of one coil, eg COILManualLoadControl
+func (e *Epever) ReadCoil(ctx context.Context, address uint16) (bool, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	words, err := e.readWords(ctx, Coil, address, 1)
+	if err != nil {
+		return false, err
+	}
+	return words[0] == 1, nil
+}
+
+// WriteCoil switches a coil on or off, then reads it back to check the
+// controller took the new state. The snapshot is updated with the state read back.
+func (e *Epever) WriteCoil(ctx context.Context, address uint16, on bool) error {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	return e.commit(ctx, []regWrite{coilWrite(address, on)})
+}
+
+func boolRaw(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
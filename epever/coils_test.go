@@ -0,0 +1,87 @@
+package epever
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteCoil(t *testing.T) {
+	slave := newFakeSlave(1)
+	slave.coils[COILOutputControlMode] = true
+	slave.coils[COILManualLoadControl] = false
+
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	ctx := context.Background()
+
+	if err := ep.WriteCoil(ctx, COILManualLoadControl, true); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := ep.ReadCoil(ctx, COILManualLoadControl); err != nil || !on {
+		t.Errorf("manual load reads %v, %v after switching on", on, err)
+	}
+	if !ep.Snapshot().CoilManualLoad {
+		t.Errorf("snapshot not updated with the state read back")
+	}
+
+	// A write the controller acknowledges but doesn't act on fails verification
+	slave.ignoreWrites = true
+	err = ep.WriteCoil(ctx, COILManualLoadControl, false)
+	var writeErr *WriteError
+	if !errors.As(err, &writeErr) || !errors.Is(err, ErrVerify) {
+		t.Errorf("expected a verify error, got %v", err)
+	}
+
+	// Coils the controller doesn't have are an exception, not retried
+	err = ep.WriteCoil(ctx, 0x0004, true)
+	if !errors.As(err, &writeErr) || !errors.Is(err, ErrException) || writeErr.Attempts != 1 {
+		t.Errorf("expected a single exception attempt, got %v", err)
+	}
+}
+
+func TestDiscreteInputs(t *testing.T) {
+	slave := newFakeSlave(1)
+	slave.fill(refreshBlocks)
+
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	rec := &recorder{}
+	ep.Observer = rec
+	ctx := context.Background()
+
+	// Both inputs come in one read from 0x2000, so night is bit 12 of it
+	for _, tc := range []struct{ overTemp, night bool }{
+		{false, false}, {true, false}, {false, true}, {true, true},
+	} {
+		slave.mu.Lock()
+		slave.discrete[DISOverTemp] = tc.overTemp
+		slave.discrete[DISDayNight] = tc.night
+		slave.mu.Unlock()
+
+		rec.attempts = nil
+		s, err := ep.Refresh(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.OverTemp != tc.overTemp || s.Night != tc.night {
+			t.Errorf("over temp %v, night %v read as %v, %v", tc.overTemp, tc.night, s.OverTemp, s.Night)
+		}
+		var reads []string
+		for _, a := range rec.attempts {
+			if strings.HasPrefix(a.Block(), "discrete") {
+				reads = append(reads, a.Block())
+			}
+		}
+		if len(reads) != 1 || reads[0] != "discrete 0x2000+13" {
+			t.Errorf("discrete inputs read as %v", reads)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package epever
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DesiredState is the configuration a controller is expected to have, as
+// register map names and values, eg BatteryConfigBoostChargingVoltage: 28.8
+type DesiredState map[string]float64
+
+// Drift is a register whose value differs from the desired state
+type Drift struct {
+	Register  Register
+	Want, Got float64
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s is %v, want %v", d.Register.Name, d.Got, d.Want)
+}
+
+// UnmarshalDesiredState reads a desired state in "json" or "yaml". Every name
+// must be a writable holding register in the register map.
+func UnmarshalDesiredState(data []byte, format string) (DesiredState, error) {
+	d := DesiredState{}
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, &d)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &d)
+	default:
+		err = fmt.Errorf("unknown desired state format %q, want json or yaml", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name := range d {
+		if _, err := d.register(name); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// register looks up a name of the desired state in the register map
+func (d DesiredState) register(name string) (Register, error) {
+	for _, r := range backupRegisters() {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return Register{}, fmt.Errorf("%w: %q is not a writable holding register", ErrInvalidConfig, name)
+}
+
+// Registers returns the registers of the desired state, sorted by name
+func (d DesiredState) Registers() []Register {
+	var regs []Register
+	for name := range d {
+		if r, err := d.register(name); err == nil {
+			regs = append(regs, r)
+		}
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Name < regs[j].Name })
+	return regs
+}
+
+// Drift compares the snapshot against the desired state. Values are compared
+// as the controller stores them, so 28.8 matches 28.80.
+func (d DesiredState) Drift(s Snapshot) []Drift {
+	var drifts []Drift
+	for _, r := range d.Registers() {
+		want := d[r.Name]
+		got := r.Value(s)
+		if r.encode(want) != r.encode(got) {
+			drifts = append(drifts, Drift{Register: r, Want: want, Got: got})
+		}
+	}
+	return drifts
+}
+
+// apply sets the desired values into the snapshot
+func (d DesiredState) apply(s *Snapshot) {
+	for _, r := range d.Registers() {
+		r.set(s, d[r.Name])
+	}
+}
+
+// EnforceDesiredState reads the controller's settings and writes back any
+// that drifted from the desired state, each block read back to check it took.
+// The battery settings are validated as a whole before they are written.
+// The drift found is returned.
+func (e *Epever) EnforceDesiredState(ctx context.Context, d DesiredState) ([]Drift, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	if _, err := e.readBackupRegisters(ctx); err != nil {
+		return nil, err
+	}
+	drifts := d.Drift(e.snapshot)
+	if len(drifts) == 0 {
+		return nil, nil
+	}
+
+	target := e.snapshot
+	d.apply(&target)
+	var writes []regWrite
+	for _, b := range backupBlocks {
+		if !drifted(b, drifts) {
+			continue
+		}
+		if b.address == batteryConfigBlock.address {
+			if err := target.BatteryConfig().Validate(); err != nil {
+				return drifts, err
+			}
+		}
+		writes = append(writes, blockWrite(b, target))
+	}
+	return drifts, e.commit(ctx, writes)
+}
+
+// drifted says whether any of the drifted registers is in the block
+func drifted(b block, drifts []Drift) bool {
+	for _, d := range drifts {
+		if d.Register.Address >= b.address && d.Register.Address < b.address+b.quantity {
+			return true
+		}
+	}
+	return false
+}
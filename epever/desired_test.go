@@ -0,0 +1,54 @@
+package epever
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEnforceDesiredState(t *testing.T) {
+	desired, err := UnmarshalDesiredState([]byte("BatteryConfigBoostChargingVoltage: 28.6\nChargeBoostDuration: 90\n"), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalDesiredState([]byte(`{"BatteryVoltage": 24}`), "json"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected a read only register to be refused, got %v", err)
+	}
+
+	slave := newFakeSlave(1)
+	for _, b := range backupBlocks {
+		for a := b.address; a < b.address+b.quantity; a++ {
+			slave.holding[a] = 0
+		}
+	}
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	ctx := context.Background()
+	if err := ep.SetBatteryConfig(ctx, testBatteryConfig); err != nil {
+		t.Fatal(err)
+	}
+	slave.holding[REGBatteryBoostDuration] = 90
+
+	drifts, err := ep.EnforceDesiredState(ctx, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 1 || drifts[0].Register.Name != "BatteryConfigBoostChargingVoltage" || drifts[0].Got != 28.8 {
+		t.Errorf("drift is %v", drifts)
+	}
+	if slave.holding[REGBatteryBoostChargingVoltage] != 2860 || slave.holding[REGBatteryFloatChargingVoltage] != 2760 {
+		t.Errorf("boost %d float %d after enforcing", slave.holding[REGBatteryBoostChargingVoltage], slave.holding[REGBatteryFloatChargingVoltage])
+	}
+	if drifts := desired.Drift(ep.Snapshot()); len(drifts) != 0 {
+		t.Errorf("still drifting after enforcing: %v", drifts)
+	}
+
+	// Settings breaking the battery rules are never written
+	desired["BatteryConfigFloatChargingVoltage"] = 29
+	if _, err := ep.EnforceDesiredState(ctx, desired); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected the battery rules to be checked, got %v", err)
+	}
+}
@@ -0,0 +1,391 @@
+// Package epever reads Epever solar charge controllers over Modbus.
+package epever
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// enumName returns the name for an enum value, coping with values the controller
+// sends that the protocol document doesn't list
+func enumName(v int, names ...string) string {
+	if v < 0 || v >= len(names) {
+		return fmt.Sprintf("Unknown(%d)", v)
+	}
+	return names[v]
+}
+
+// StatusBatteryTempType
+type StatusBatteryTempType int
+
+const (
+	NormalTemp StatusBatteryTempType = iota
+	OverTemp
+	LowTemp
+)
+
+func (me StatusBatteryTempType) String() string {
+	return enumName(int(me), "NormalTemp", "OverTemp", "LowTemp")
+}
+
+// StatusBatteryVoltType
+type StatusBatteryVoltType int
+
+const (
+	NormalVolt StatusBatteryVoltType = iota
+	OverVolt
+	UnderVolt
+	LowVoltDisconnect
+	FaultVolt
+)
+
+func (me StatusBatteryVoltType) String() string {
+	return enumName(int(me), "NormalVolt", "OverVolt", "UnderVolt", "LowVoltDisconnect", "FaultVolt")
+}
+
+// StatusChargingStatusType
+type StatusChargingStatusType int
+
+const (
+	NoCharging StatusChargingStatusType = iota
+	FaultCharging
+	PromoteCharging
+	EqualibriumCharging
+)
+
+func (me StatusChargingStatusType) String() string {
+	return enumName(int(me), "NoCharging", "Fault", "PromoteCharging", "EqualibriumCharging")
+}
+
+// StatusChargingInputVoltStatusType
+type StatusChargingInputVoltStatusType int
+
+const (
+	NormalInputVolt StatusChargingInputVoltStatusType = iota
+	NoPowerInputVolt
+	HigherInputVolt
+	ErrorInputVolt
+)
+
+func (me StatusChargingInputVoltStatusType) String() string {
+	return enumName(int(me), "NormalInputVolt", "NoPowerInputVolt", "HigherInputVolt", "ErrorInputVolt")
+}
+
+// StatusDischargingInputVoltType
+type StatusDischargingInputVoltType int
+
+const (
+	NormalDischargeInputVolt StatusDischargingInputVoltType = iota
+	LowDischargeInputVolt
+	HighDischargeInputVolt
+	NoAccessDischargeInputVolt
+)
+
+func (me StatusDischargingInputVoltType) String() string {
+	return enumName(int(me), "NormalDischargeInputVolt", "LowDischargeInputVolt", "HighDischargeInputVolt", "NoAccessDischargeInputVolt")
+}
+
+// StatusDischargingOutputPowerType
+type StatusDischargingOutputPowerType int
+
+const (
+	LightLoad StatusDischargingOutputPowerType = iota
+	ModerateLoad
+	RatedLoad
+	OverLoad
+)
+
+func (me StatusDischargingOutputPowerType) String() string {
+	return enumName(int(me), "LightLoad", "ModerateLoad", "RatedLoad", "OverLoad")
+}
+
+// BatteryRatedVoltageType
+type BatteryRatedVoltageType int
+
+const (
+	AutoRatedVoltage BatteryRatedVoltageType = iota
+	RatedVoltage12V
+	RatedVoltage24V
+	RatedVoltage36V
+	RatedVoltage48V
+	RatedVoltage60V
+	RatedVoltage110V
+	RatedVoltage120V
+	RatedVoltage220V
+	RatedVoltage240V
+)
+
+func (me BatteryRatedVoltageType) String() string {
+	return enumName(int(me), "Auto", "12V", "24V", "36V", "48V", "60V", "110V", "120V", "220V", "240V")
+}
+
+// Amount is the voltage in volts, 0 for Auto
+func (me BatteryRatedVoltageType) Amount() float64 {
+	volts := []float64{0, 12, 24, 36, 48, 60, 110, 120, 220, 240}
+	if me < 0 || int(me) >= len(volts) {
+		return 0
+	}
+	return volts[me]
+}
+
+// BatteryManagementModeType
+type BatteryManagementModeType int
+
+const (
+	VoltageCompensation BatteryManagementModeType = iota
+	SOCManagement
+)
+
+func (me BatteryManagementModeType) String() string {
+	return enumName(int(me), "VoltageCompensation", "SOC")
+}
+
+// LoadControlModeType
+type LoadControlModeType int
+
+const (
+	ManualLoadControl LoadControlModeType = iota
+	LightOnOff
+	LightOnTimer
+	TimeControl
+)
+
+func (me LoadControlModeType) String() string {
+	return enumName(int(me), "Manual", "LightOnOff", "LightOnTimer", "TimeControl")
+}
+
+// LoadTimingSelectionType
+type LoadTimingSelectionType int
+
+const (
+	OneTimer LoadTimingSelectionType = iota
+	TwoTimers
+)
+
+func (me LoadTimingSelectionType) String() string {
+	return enumName(int(me), "OneTimer", "TwoTimers")
+}
+
+// Epever is one controller, addressed by its slave id on a bus
+type Epever struct {
+	Retry    RetryPolicy // How failed reads are retried
+	Writes   WritePolicy // Dry run and audit log for writes
+	Observer Observer    // Told about every request attempt, nil for none
+
+	bus     *Bus
+	slaveID byte
+	name    string
+	client  modbus.Client
+
+	snapshot Snapshot
+	split    map[blockKey]bool // Merged reads the device refused, read in parts instead
+}
+
+// Create a new Epever with slave id 1 alone on the given address eg
+// "/dev/ttyXRUSB0" or "tcp://192.168.1.20:502", see NewTransport for the accepted forms
+func NewEpever(address string) (*Epever, error) {
+	bus, err := NewBus(address)
+	if err != nil {
+		return nil, err
+	}
+	return NewEpeverOnBus(bus, 1, ""), nil
+}
+
+// Create a new Epever with the given slave id on a shared bus. The name is
+// free text used to tell controllers apart, eg in metrics labels.
+func NewEpeverOnBus(bus *Bus, slaveID byte, name string) *Epever {
+	return &Epever{
+		Retry:   DefaultRetryPolicy,
+		bus:     bus,
+		slaveID: slaveID,
+		name:    name,
+		client:  bus.transport.Client(slaveID),
+	}
+}
+
+// Bus the controller is on
+func (e *Epever) Bus() *Bus {
+	return e.bus
+}
+
+// SlaveID of the controller on its bus
+func (e *Epever) SlaveID() byte {
+	return e.slaveID
+}
+
+// Name given to the controller, defaults to its bus address and slave id
+func (e *Epever) Name() string {
+	if e.name == "" {
+		return fmt.Sprintf("%s#%d", e.bus, e.slaveID)
+	}
+	return e.name
+}
+
+// Connect opens the bus, closing any existing connection first
+func (e *Epever) Connect(ctx context.Context) error {
+	return e.bus.Connect(ctx)
+}
+
+// Close the bus connection, which is shared by every controller on the bus
+func (e *Epever) Close() error {
+	return e.bus.Close()
+}
+
+// transact runs fn against the client, connecting first and retrying as the
+// policy allows. Each attempt is reported to the observer. It returns how many
+// attempts were made and, on failure, the class of the last error. Caller must
+// hold the bus mutex.
+func (e *Epever) transact(ctx context.Context, a Attempt, fn func(modbus.Client) ([]byte, error)) ([]byte, int, ErrorClass, error) {
+	attempts := e.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		var opened bool
+		if opened, err = e.bus.connect(ctx); err == nil {
+			if opened && e.bus.connects > 1 && e.Observer != nil {
+				e.Observer.ObserveReconnect(e)
+			}
+			var data []byte
+			data, err = fn(e.client)
+			if err == nil {
+				e.observe(a, started, nil, 0)
+				return data, attempt, 0, nil
+			}
+		}
+
+		class := classify(err)
+		e.observe(a, started, err, class)
+		switch class {
+		case ClassDisconnected:
+			e.bus.disconnect()
+		case ClassException:
+			// The slave answered, so the connection is fine
+		default:
+			// Drop the connection so the next attempt starts from a clean frame
+			e.bus.close()
+		}
+		if !retryable(class) || attempt >= attempts {
+			return nil, attempt, class, err
+		}
+		fmt.Printf("Error talking to %s at %x (attempt %d/%d): %v\n", e.Name(), a.Address, attempt, attempts, err)
+		if serr := sleepContext(ctx, e.Retry.Backoff(attempt)); serr != nil {
+			return nil, attempt, classify(serr), serr
+		}
+	}
+}
+
+// observe reports an attempt started at started to the observer
+func (e *Epever) observe(a Attempt, started time.Time, err error, class ErrorClass) {
+	if e.Observer == nil {
+		return
+	}
+	a.Duration = time.Since(started)
+	a.Err = err
+	a.Class = class
+	e.Observer.ObserveAttempt(e, a)
+}
+
+// read runs fn as a read request. Caller must hold the bus mutex.
+func (e *Epever) read(ctx context.Context, table Table, address uint16, quantity uint16, fn func(modbus.Client) ([]byte, error)) ([]byte, error) {
+	data, attempts, class, err := e.transact(ctx, Attempt{Table: table, Address: address, Quantity: quantity}, fn)
+	if err != nil {
+		return nil, &ReadError{Address: address, Quantity: quantity, Attempts: attempts, Class: class, Err: err}
+	}
+	return data, nil
+}
+
+// write runs fn as a write request. Caller must hold the bus mutex.
+func (e *Epever) write(ctx context.Context, table Table, address uint16, quantity uint16, fn func(modbus.Client) ([]byte, error)) error {
+	_, attempts, class, err := e.transact(ctx, Attempt{Table: table, Write: true, Address: address, Quantity: quantity}, fn)
+	if err != nil {
+		return &WriteError{Address: address, Quantity: quantity, Attempts: attempts, Class: class, Err: err}
+	}
+	return nil
+}
+
+// Read some registers, coils or discrete inputs and reconnect/retry if needed.
+func (e *Epever) readTable(ctx context.Context, table Table, address uint16, quantity uint16) ([]byte, error) {
+	return e.read(ctx, table, address, quantity, func(c modbus.Client) ([]byte, error) {
+		switch table {
+		case HoldingRegister:
+			return c.ReadHoldingRegisters(address, quantity)
+		case Coil:
+			return c.ReadCoils(address, quantity)
+		case DiscreteInput:
+			return c.ReadDiscreteInputs(address, quantity)
+		}
+		return c.ReadInputRegisters(address, quantity)
+	})
+}
+
+// Read some input registers and reconnect/retry if needed.
+func (e *Epever) readWithRetry(ctx context.Context, address uint16, quantity uint16) ([]byte, error) {
+	return e.readTable(ctx, InputRegister, address, quantity)
+}
+
+// Read some holding registers and reconnect/retry if needed.
+func (e *Epever) readHoldingWithRetry(ctx context.Context, address uint16, quantity uint16) ([]byte, error) {
+	return e.readTable(ctx, HoldingRegister, address, quantity)
+}
+
+// Snapshot returns the values decoded by the most recent Refresh or RefreshGroup
+func (e *Epever) Snapshot() Snapshot {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	return e.snapshot
+}
+
+// Show the most recent snapshot as a string
+func (e *Epever) String() string {
+	return e.Snapshot().String()
+}
+
+// Refresh reads every block in the register map and decodes it. If any read
+// fails the error is returned and the previous snapshot is kept.
+//
+// The context is checked between attempts and bounds the backoff and the
+// connect, but a request already sent runs until the transport's timeout, so
+// a deadline can be overrun by up to that timeout.
+func (e *Epever) Refresh(ctx context.Context) (Snapshot, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	var s Snapshot
+	if err := e.readBlocks(ctx, refreshBlocks, &s); err != nil {
+		return Snapshot{}, err
+	}
+
+	s.Taken = time.Now()
+	s.RTCTaken = s.Taken
+	e.snapshot = s
+	return s, nil
+}
+
+// RefreshGroup reads the blocks of one poll group into the snapshot, keeping
+// the values of the other groups. If any read fails the error is returned and
+// the snapshot is unchanged.
+func (e *Epever) RefreshGroup(ctx context.Context, g PollGroup) (Snapshot, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	s := e.snapshot
+	if err := e.readBlocks(ctx, groupBlocks[g], &s); err != nil {
+		return Snapshot{}, err
+	}
+
+	switch g {
+	case RealtimeGroup:
+		s.Taken = time.Now()
+	case RTCGroup:
+		s.RTCTaken = time.Now()
+	}
+	e.snapshot = s
+	return s, nil
+}
@@ -0,0 +1,133 @@
+package epever
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// ErrorClass says what kind of failure a read ran into
+type ErrorClass int
+
+const (
+	ClassDisconnected ErrorClass = iota
+	ClassTimeout
+	ClassCRC
+	ClassException
+	ClassCanceled
+	ClassVerify
+)
+
+func (me ErrorClass) String() string {
+	return [...]string{"disconnected", "timeout", "crc", "exception", "canceled", "verify"}[me]
+}
+
+// Sentinel errors, one per class, so callers can use errors.Is
+var (
+	ErrDisconnected = errors.New("epever: disconnected")
+	ErrTimeout      = errors.New("epever: timeout")
+	ErrCRC          = errors.New("epever: bad frame or crc")
+	ErrException    = errors.New("epever: modbus exception")
+	ErrCanceled     = errors.New("epever: canceled")
+	ErrVerify       = errors.New("epever: value read back differs from value written")
+)
+
+var classErrors = [...]error{ErrDisconnected, ErrTimeout, ErrCRC, ErrException, ErrCanceled, ErrVerify}
+
+// ReadError is returned when a register block could not be read
+type ReadError struct {
+	Address  uint16
+	Quantity uint16
+	Attempts int
+	Class    ErrorClass
+	Err      error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("epever: read 0x%04x+%d failed after %d attempt(s) (%s): %v", e.Address, e.Quantity, e.Attempts, e.Class, e.Err)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel error for this class
+func (e *ReadError) Is(target error) bool {
+	return target == classErrors[e.Class]
+}
+
+// ExceptionCode returns the modbus exception code if the device answered with one
+func (e *ReadError) ExceptionCode() (byte, bool) {
+	return exceptionCode(e.Err)
+}
+
+// WriteError is returned when a coil or register could not be written, or
+// did not read back as written
+type WriteError struct {
+	Address  uint16
+	Quantity uint16
+	Attempts int
+	Class    ErrorClass
+	Err      error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("epever: write 0x%04x+%d failed after %d attempt(s) (%s): %v", e.Address, e.Quantity, e.Attempts, e.Class, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel error for this class
+func (e *WriteError) Is(target error) bool {
+	return target == classErrors[e.Class]
+}
+
+// ExceptionCode returns the modbus exception code if the device answered with one
+func (e *WriteError) ExceptionCode() (byte, bool) {
+	return exceptionCode(e.Err)
+}
+
+func exceptionCode(err error) (byte, bool) {
+	var mbErr *modbus.ModbusError
+	if errors.As(err, &mbErr) {
+		return mbErr.ExceptionCode, true
+	}
+	return 0, false
+}
+
+// classify works out which class an error from the modbus library belongs to.
+// The library reports framing problems as plain strings, so those are matched by text.
+func classify(err error) ErrorClass {
+	var mbErr *modbus.ModbusError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, serial.ErrTimeout),
+		errors.Is(err, os.ErrDeadlineExceeded):
+		return ClassTimeout
+	case errors.As(err, &mbErr):
+		return ClassException
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
+	}
+
+	msg := err.Error()
+	if strings.HasPrefix(msg, "modbus: ") &&
+		(strings.Contains(msg, "crc") ||
+			strings.Contains(msg, "does not match") ||
+			strings.Contains(msg, "response length") ||
+			strings.Contains(msg, "response data")) {
+		return ClassCRC
+	}
+	return ClassDisconnected
+}
@@ -0,0 +1,273 @@
+package epever
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSlave is a minimal modbus slave used to test the driver without hardware
+type fakeSlave struct {
+	mu       sync.Mutex
+	slaveID  byte
+	input    map[uint16]uint16
+	holding  map[uint16]uint16
+	coils    map[uint16]bool
+	discrete map[uint16]bool
+	requests int
+	baud     int // Answer as slowly as a serial link at this rate would, 0 for at once
+	drop     int // Requests still to swallow without an answer, like a noisy line
+
+	ignoreWrites   bool            // Acknowledge writes without storing them, like a controller in the wrong mode
+	ignoreWritesAt map[uint16]bool // Likewise, only for register writes starting at these addresses
+}
+
+func newFakeSlave(slaveID byte) *fakeSlave {
+	return &fakeSlave{
+		slaveID:  slaveID,
+		input:    map[uint16]uint16{},
+		holding:  map[uint16]uint16{},
+		coils:    map[uint16]bool{},
+		discrete: map[uint16]bool{},
+
+		ignoreWritesAt: map[uint16]bool{},
+	}
+}
+
+// fill gives every register of the blocks a zero value, so they can be read
+func (f *fakeSlave) fill(blocks []block) {
+	for _, b := range blocks {
+		for a := b.address; a < b.address+b.quantity; a++ {
+			switch b.table {
+			case InputRegister:
+				f.input[a] = 0
+			case HoldingRegister:
+				f.holding[a] = 0
+			case Coil:
+				f.coils[a] = false
+			case DiscreteInput:
+				f.discrete[a] = false
+			}
+		}
+	}
+}
+
+// handle answers one request pdu with a response pdu
+func (f *fakeSlave) handle(function byte, data []byte) (byte, []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+
+	address := binary.BigEndian.Uint16(data)
+	quantity := binary.BigEndian.Uint16(data[2:])
+	var table map[uint16]uint16
+	switch function {
+	case 1, 2:
+		bits := f.coils
+		if function == 2 {
+			bits = f.discrete
+		}
+		resp := []byte{byte((quantity + 7) / 8)}
+		resp = append(resp, make([]byte, resp[0])...)
+		for i := uint16(0); i < quantity; i++ {
+			on, ok := bits[address+i]
+			if !ok {
+				return function | 0x80, []byte{2}
+			}
+			if on {
+				resp[1+i/8] |= 1 << (i % 8)
+			}
+		}
+		return function, resp
+	case 5:
+		if _, ok := f.coils[address]; !ok {
+			return function | 0x80, []byte{2}
+		}
+		if !f.ignoreWrites {
+			f.coils[address] = quantity == 0xff00
+		}
+		return function, data[:4]
+	case 3:
+		table = f.holding
+	case 4:
+		table = f.input
+	case 16:
+		if f.ignoreWrites || f.ignoreWritesAt[address] {
+			return function, data[:4]
+		}
+		values := data[5:]
+		for i := uint16(0); i < quantity; i++ {
+			f.holding[address+i] = binary.BigEndian.Uint16(values[2*i:])
+		}
+		return function, data[:4]
+	default:
+		return function | 0x80, []byte{1}
+	}
+
+	resp := []byte{byte(2 * quantity)}
+	for i := uint16(0); i < quantity; i++ {
+		v, ok := table[address+i]
+		if !ok {
+			return function | 0x80, []byte{2}
+		}
+		resp = append(resp, byte(v>>8), byte(v))
+	}
+	return function, resp
+}
+
+// serveTCP answers Modbus TCP (mbap) frames on a loopback listener
+func (f *fakeSlave) serveTCP(t testing.TB) string {
+	return newFakeBus(f).serveTCP(t)
+}
+
+// fakeBus is several fake slaves sharing a gateway, each answering only its
+// own slave id. It notes any requests that overlapped, which a real RS-485
+// line can't carry.
+type fakeBus struct {
+	slaves map[byte]*fakeSlave
+
+	mu       sync.Mutex
+	active   int
+	overlaps int
+}
+
+func newFakeBus(slaves ...*fakeSlave) *fakeBus {
+	b := &fakeBus{slaves: map[byte]*fakeSlave{}}
+	for _, f := range slaves {
+		b.slaves[f.slaveID] = f
+	}
+	return b
+}
+
+// swallow says if the slave drops this request instead of answering it
+func (f *fakeSlave) swallow() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.drop > 0 {
+		f.drop--
+		return true
+	}
+	return false
+}
+
+// serveTCP answers Modbus TCP (mbap) frames on a loopback listener. Requests
+// for a slave id nobody has, or that the slave drops, go unanswered.
+func (b *fakeBus) serveTCP(t testing.TB) string {
+	return listen(t, func(conn net.Conn) error {
+		header := make([]byte, 7)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return err
+		}
+		pdu := make([]byte, binary.BigEndian.Uint16(header[4:])-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return err
+		}
+		f := b.slaves[header[6]]
+		if f == nil || f.swallow() {
+			return nil
+		}
+
+		b.mu.Lock()
+		b.active++
+		if b.active > 1 {
+			b.overlaps++
+		}
+		b.mu.Unlock()
+		function, data := f.handle(pdu[0], pdu[1:])
+		f.transmit(len(pdu), len(data)+1)
+		b.mu.Lock()
+		b.active--
+		b.mu.Unlock()
+
+		resp := append([]byte{}, header[:7]...)
+		binary.BigEndian.PutUint16(resp[4:], uint16(len(data)+2))
+		resp = append(resp, function)
+		resp = append(resp, data...)
+		_, err := conn.Write(resp)
+		return err
+	})
+}
+
+// serveRTU answers RTU frames on a loopback listener, like ser2net would
+func (f *fakeSlave) serveRTU(t testing.TB) string {
+	return listen(t, func(conn net.Conn) error {
+		return f.answerRTU(conn)
+	})
+}
+
+// answerRTU reads one RTU request from rw and writes the response
+func (f *fakeSlave) answerRTU(rw io.ReadWriter) error {
+	req := make([]byte, 8)
+	if _, err := io.ReadFull(rw, req); err != nil {
+		return err
+	}
+	if req[1] == 16 {
+		rest := make([]byte, int(req[6])+1)
+		if _, err := io.ReadFull(rw, rest); err != nil {
+			return err
+		}
+		req = append(req, rest...)
+	}
+	if crc16(req[:len(req)-2]) != binary.LittleEndian.Uint16(req[len(req)-2:]) || req[0] != f.slaveID {
+		return nil
+	}
+	function, data := f.handle(req[1], req[2:len(req)-2])
+	resp := append([]byte{req[0], function}, data...)
+	resp = append(resp, 0, 0)
+	binary.LittleEndian.PutUint16(resp[len(resp)-2:], crc16(resp[:len(resp)-2]))
+	_, err := rw.Write(resp)
+	return err
+}
+
+// transmit waits as long as an RTU request and response with pdus of these
+// lengths would take on the wire: 10 bits a byte with the slave id and crc,
+// the 3.5 character silence ending each frame, and the controller's turnaround
+func (f *fakeSlave) transmit(request, response int) {
+	if f.baud == 0 {
+		return
+	}
+	const turnaround = 5 * time.Millisecond
+	chars := float64(request+3) + float64(response+3) + 2*3.5
+	time.Sleep(turnaround + time.Duration(chars*10/float64(f.baud)*float64(time.Second)))
+}
+
+// listen serves each connection to a loopback listener with answer until it fails
+func listen(t testing.TB, answer func(net.Conn) error) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for answer(conn) == nil {
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func crc16(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
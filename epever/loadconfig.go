@@ -0,0 +1,181 @@
+package epever
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeOfDay is a turn on or off time of the load timers
+type TimeOfDay struct {
+	Hour, Min, Sec uint16
+}
+
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d:%02d", t.Hour, t.Min, t.Sec)
+}
+
+// parseTimeOfDay reads hh:mm or hh:mm:ss
+func parseTimeOfDay(value string) (TimeOfDay, error) {
+	var t TimeOfDay
+	n, _ := fmt.Sscanf(value, "%d:%d:%d", &t.Hour, &t.Min, &t.Sec)
+	if n < 2 || strings.Count(value, ":") != n-1 {
+		return TimeOfDay{}, fmt.Errorf("want hh:mm or hh:mm:ss, not %q", value)
+	}
+	return t, nil
+}
+
+// LoadConfig is the load output and street light settings
+type LoadConfig struct {
+	Mode LoadControlModeType
+
+	// Light on/off: night starts once the PV voltage has been below
+	// NightThresholdVoltage for LightOnDelay minutes, and day likewise
+	NightThresholdVoltage float64
+	LightOnDelay          uint16
+	DayThresholdVoltage   float64
+	LightOffDelay         uint16
+
+	// Light on + timer: the load runs for the working times after dusk
+	WorkingTime1 time.Duration
+	WorkingTime2 time.Duration
+
+	// Time control: the load runs between these times
+	TurnOn1  TimeOfDay
+	TurnOff1 TimeOfDay
+	TurnOn2  TimeOfDay
+	TurnOff2 TimeOfDay
+
+	NightLength time.Duration
+	Timing      LoadTimingSelectionType
+	DefaultOn   bool // Load state in manual mode
+}
+
+// hoursMinutes splits a duration into the hour and minute bytes of a register
+func hoursMinutes(d time.Duration) (uint16, uint16) {
+	m := uint16(d / time.Minute)
+	return m / 60, m % 60
+}
+
+// LoadConfig returns the load settings read into the snapshot
+func (s Snapshot) LoadConfig() LoadConfig {
+	return LoadConfig{
+		Mode:                  s.LoadControlMode,
+		NightThresholdVoltage: s.LoadNightThresholdVoltage,
+		LightOnDelay:          s.LoadLightOnDelay,
+		DayThresholdVoltage:   s.LoadDayThresholdVoltage,
+		LightOffDelay:         s.LoadLightOffDelay,
+		WorkingTime1:          time.Duration(s.LoadWorkingTime1Hour)*time.Hour + time.Duration(s.LoadWorkingTime1Min)*time.Minute,
+		WorkingTime2:          time.Duration(s.LoadWorkingTime2Hour)*time.Hour + time.Duration(s.LoadWorkingTime2Min)*time.Minute,
+		TurnOn1:               TimeOfDay{s.LoadTurnOn1Hour, s.LoadTurnOn1Min, s.LoadTurnOn1Sec},
+		TurnOff1:              TimeOfDay{s.LoadTurnOff1Hour, s.LoadTurnOff1Min, s.LoadTurnOff1Sec},
+		TurnOn2:               TimeOfDay{s.LoadTurnOn2Hour, s.LoadTurnOn2Min, s.LoadTurnOn2Sec},
+		TurnOff2:              TimeOfDay{s.LoadTurnOff2Hour, s.LoadTurnOff2Min, s.LoadTurnOff2Sec},
+		NightLength:           time.Duration(s.LoadNightLengthHour)*time.Hour + time.Duration(s.LoadNightLengthMin)*time.Minute,
+		Timing:                s.LoadTimingSelection,
+		DefaultOn:             s.LoadDefaultOn,
+	}
+}
+
+// apply copies the settings into the snapshot fields they are encoded from
+func (c LoadConfig) apply(s *Snapshot) {
+	s.LoadControlMode = c.Mode
+	s.LoadNightThresholdVoltage = c.NightThresholdVoltage
+	s.LoadLightOnDelay = c.LightOnDelay
+	s.LoadDayThresholdVoltage = c.DayThresholdVoltage
+	s.LoadLightOffDelay = c.LightOffDelay
+	s.LoadWorkingTime1Hour, s.LoadWorkingTime1Min = hoursMinutes(c.WorkingTime1)
+	s.LoadWorkingTime2Hour, s.LoadWorkingTime2Min = hoursMinutes(c.WorkingTime2)
+	s.LoadTurnOn1Hour, s.LoadTurnOn1Min, s.LoadTurnOn1Sec = c.TurnOn1.Hour, c.TurnOn1.Min, c.TurnOn1.Sec
+	s.LoadTurnOff1Hour, s.LoadTurnOff1Min, s.LoadTurnOff1Sec = c.TurnOff1.Hour, c.TurnOff1.Min, c.TurnOff1.Sec
+	s.LoadTurnOn2Hour, s.LoadTurnOn2Min, s.LoadTurnOn2Sec = c.TurnOn2.Hour, c.TurnOn2.Min, c.TurnOn2.Sec
+	s.LoadTurnOff2Hour, s.LoadTurnOff2Min, s.LoadTurnOff2Sec = c.TurnOff2.Hour, c.TurnOff2.Min, c.TurnOff2.Sec
+	s.LoadNightLengthHour, s.LoadNightLengthMin = hoursMinutes(c.NightLength)
+	s.LoadTimingSelection = c.Timing
+	s.LoadDefaultOn = c.DefaultOn
+}
+
+// Set changes one setting by field name, ignoring case. Times of day are
+// hh:mm[:ss], durations are Go durations like 5h30m, modes are their names.
+func (c *LoadConfig) Set(name, value string) error {
+	return setField(c, name, value)
+}
+
+// Validate checks every time fits the controller's registers
+func (c LoadConfig) Validate() error {
+	var problems []string
+	if c.Mode < ManualLoadControl || c.Mode > TimeControl {
+		problems = append(problems, fmt.Sprintf("mode %d must be 0-3", c.Mode))
+	}
+	if c.Timing < OneTimer || c.Timing > TwoTimers {
+		problems = append(problems, fmt.Sprintf("timing %d must be 0-1", c.Timing))
+	}
+	for _, d := range []struct {
+		name string
+		d    time.Duration
+	}{{"working time 1", c.WorkingTime1}, {"working time 2", c.WorkingTime2}, {"night length", c.NightLength}} {
+		if d.d < 0 || d.d >= 24*time.Hour || d.d%time.Minute != 0 {
+			problems = append(problems, fmt.Sprintf("%s %v must be whole minutes under 24h", d.name, d.d))
+		}
+	}
+	for _, t := range []struct {
+		name string
+		t    TimeOfDay
+	}{{"turn on 1", c.TurnOn1}, {"turn off 1", c.TurnOff1}, {"turn on 2", c.TurnOn2}, {"turn off 2", c.TurnOff2}} {
+		if t.t.Hour > 23 || t.t.Min > 59 || t.t.Sec > 59 {
+			problems = append(problems, fmt.Sprintf("%s %v is not a time of day", t.name, t.t))
+		}
+	}
+	if c.DayThresholdVoltage <= c.NightThresholdVoltage {
+		problems = append(problems, fmt.Sprintf("day threshold %.2fV must be above night threshold %.2fV", c.DayThresholdVoltage, c.NightThresholdVoltage))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// loadConfigBlocks is the read and write plan for the load settings
+var loadConfigBlocks = planBlocks(append(append(append(append(
+	registersIn(HoldingRegister, REGNightTimeThresholdVolt, REGLightOffDelay),
+	registersIn(HoldingRegister, REGLoadControlMode, REGLoadWorkingTime2)...),
+	registersIn(HoldingRegister, REGLoadTurnOn1Sec, REGLoadTurnOff2Hour)...),
+	registersIn(HoldingRegister, REGLengthOfNight, REGLengthOfNight)...),
+	registersIn(HoldingRegister, REGLoadTimingSelection, REGDefaultLoadManual)...))
+
+// ReadLoadConfig reads the load settings
+func (e *Epever) ReadLoadConfig(ctx context.Context) (LoadConfig, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	for _, b := range loadConfigBlocks {
+		data, err := e.readTable(ctx, b.table, b.address, b.quantity)
+		if err != nil {
+			return LoadConfig{}, err
+		}
+		b.decode(&e.snapshot, data)
+	}
+	return e.snapshot.LoadConfig(), nil
+}
+
+// SetLoadConfig validates the load settings and writes them, one request per
+// contiguous block, reading each back to check the controller took it. If
+// any block fails they are all rolled back.
+func (e *Epever) SetLoadConfig(ctx context.Context, c LoadConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	var s Snapshot
+	c.apply(&s)
+	var writes []regWrite
+	for _, b := range loadConfigBlocks {
+		writes = append(writes, blockWrite(b, s))
+	}
+	return e.commit(ctx, writes)
+}
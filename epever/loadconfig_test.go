@@ -0,0 +1,61 @@
+package epever
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetLoadConfig(t *testing.T) {
+	slave := newFakeSlave(1)
+	for _, b := range loadConfigBlocks {
+		for a := b.address; a < b.address+b.quantity; a++ {
+			slave.holding[a] = 0
+		}
+	}
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	ctx := context.Background()
+
+	var want LoadConfig
+	for _, set := range [][2]string{
+		{"mode", "LightOnTimer"},
+		{"NightThresholdVoltage", "5"},
+		{"LightOnDelay", "10"},
+		{"DayThresholdVoltage", "6"},
+		{"LightOffDelay", "10"},
+		{"WorkingTime1", "4h30m"},
+		{"TurnOn1", "18:30"},
+		{"TurnOff1", "23:15:10"},
+		{"NightLength", "10h"},
+		{"Timing", "TwoTimers"},
+		{"DefaultOn", "true"},
+	} {
+		if err := want.Set(set[0], set[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want.WorkingTime1 != 4*time.Hour+30*time.Minute || want.TurnOff1 != (TimeOfDay{23, 15, 10}) || want.Mode != LightOnTimer {
+		t.Fatalf("settings parsed as %+v", want)
+	}
+
+	if err := ep.SetLoadConfig(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	if got := slave.holding[REGLoadWorkingTime1]; got != 4<<8|30 {
+		t.Errorf("working time 1 register holds 0x%04x", got)
+	}
+	if got, err := ep.ReadLoadConfig(ctx); err != nil || got != want {
+		t.Errorf("read back %+v, %v", got, err)
+	}
+
+	bad := want
+	bad.TurnOn2 = TimeOfDay{24, 0, 0}
+	if err := ep.SetLoadConfig(ctx, bad); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected an invalid time of day to be refused, got %v", err)
+	}
+}
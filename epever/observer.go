@@ -0,0 +1,38 @@
+package epever
+
+import (
+	"fmt"
+	"time"
+)
+
+// Observer is told about every request attempt and reconnect, eg to export
+// them as metrics. It is called with the bus mutex held, so it must be quick
+// and must not call back into the controller.
+type Observer interface {
+	ObserveAttempt(e *Epever, a Attempt)
+	ObserveReconnect(e *Epever)
+}
+
+// Attempt is one try at a modbus request
+type Attempt struct {
+	Table    Table
+	Write    bool
+	Address  uint16
+	Quantity uint16
+	Duration time.Duration // Including any connect it needed
+	Err      error         // nil if it succeeded
+	Class    ErrorClass    // Of Err
+}
+
+// Block names the registers requested, eg "input 0x3100+18"
+func (a Attempt) Block() string {
+	return fmt.Sprintf("%s 0x%04x+%d", a.Table, a.Address, a.Quantity)
+}
+
+// Op is "read" or "write"
+func (a Attempt) Op() string {
+	if a.Write {
+		return "write"
+	}
+	return "read"
+}
@@ -0,0 +1,56 @@
+package epever
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// recorder is an Observer keeping what it was told
+type recorder struct {
+	attempts   []Attempt
+	reconnects int
+}
+
+func (r *recorder) ObserveAttempt(e *Epever, a Attempt) { r.attempts = append(r.attempts, a) }
+func (r *recorder) ObserveReconnect(e *Epever)          { r.reconnects++ }
+
+func TestObserver(t *testing.T) {
+	slave := newFakeSlave(1)
+	slave.holding[REGBatteryRatedVoltage] = 2
+
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	rec := &recorder{}
+	ep.Observer = rec
+	ctx := context.Background()
+
+	if _, err := ep.ReadSystemVoltage(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.attempts) != 1 || rec.attempts[0].Err != nil || rec.attempts[0].Op() != "read" ||
+		rec.attempts[0].Block() != "holding 0x9067+1" || rec.reconnects != 0 {
+		t.Errorf("first read observed as %+v, %d reconnects", rec.attempts, rec.reconnects)
+	}
+
+	// An exception is one failed attempt, and the connection is kept
+	_, err = ep.ReadCoil(ctx, 0x0004)
+	if !errors.Is(err, ErrException) {
+		t.Fatalf("expected an exception, got %v", err)
+	}
+	if a := rec.attempts[len(rec.attempts)-1]; a.Err == nil || a.Class != ClassException || a.Table != Coil {
+		t.Errorf("exception observed as %+v", a)
+	}
+
+	// Connecting again after the connection was dropped is a reconnect
+	ep.Close()
+	if _, err := ep.ReadSystemVoltage(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.reconnects != 1 {
+		t.Errorf("%d reconnects observed, want 1", rec.reconnects)
+	}
+}
@@ -0,0 +1,167 @@
+package epever
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BatteryProfile is a set of battery voltages for one chemistry, given for a
+// nominal system voltage and scaled to the system it is applied to
+type BatteryProfile struct {
+	Nominal     float64 `json:"nominal" yaml:"nominal"` // System voltage the voltages below are for, eg 12
+	BatteryType uint16  `json:"battery_type" yaml:"battery_type"`
+	TempCoef    float64 `json:"temp_coef" yaml:"temp_coef"`
+
+	OverVoltDisconnect                float64 `json:"over_volt_disconnect" yaml:"over_volt_disconnect"`
+	ChargingLimitVoltage              float64 `json:"charging_limit" yaml:"charging_limit"`
+	OverVoltageReconnect              float64 `json:"over_volt_reconnect" yaml:"over_volt_reconnect"`
+	EqualizeChargingVoltage           float64 `json:"equalize" yaml:"equalize"`
+	BoostChargingVoltage              float64 `json:"boost" yaml:"boost"`
+	FloatChargingVoltage              float64 `json:"float" yaml:"float"`
+	BoostReconnectChargingVoltage     float64 `json:"boost_reconnect" yaml:"boost_reconnect"`
+	LowVoltageReconnectVoltage        float64 `json:"low_volt_reconnect" yaml:"low_volt_reconnect"`
+	UnderVoltageWarningRecoverVoltage float64 `json:"under_volt_warning_recover" yaml:"under_volt_warning_recover"`
+	UnderVoltageWarningVoltage        float64 `json:"under_volt_warning" yaml:"under_volt_warning"`
+	LowVoltageDisconnectVoltage       float64 `json:"low_volt_disconnect" yaml:"low_volt_disconnect"`
+	DischargingLimitVoltage           float64 `json:"discharging_limit" yaml:"discharging_limit"`
+}
+
+// BuiltinProfiles are the battery profiles every controller can be given.
+// They all use the user battery type, as the controller ignores written
+// voltages for its own types. The lead acid voltages are Epever's defaults.
+var BuiltinProfiles = map[string]BatteryProfile{
+	"agm": {Nominal: 12, BatteryType: 0, TempCoef: 3,
+		OverVoltDisconnect: 16, ChargingLimitVoltage: 15, OverVoltageReconnect: 15,
+		EqualizeChargingVoltage: 14.6, BoostChargingVoltage: 14.4, FloatChargingVoltage: 13.8, BoostReconnectChargingVoltage: 13.2,
+		LowVoltageReconnectVoltage: 12.6, UnderVoltageWarningRecoverVoltage: 12.2, UnderVoltageWarningVoltage: 12,
+		LowVoltageDisconnectVoltage: 11.1, DischargingLimitVoltage: 10.6},
+	"gel": {Nominal: 12, BatteryType: 0, TempCoef: 3,
+		OverVoltDisconnect: 16, ChargingLimitVoltage: 15, OverVoltageReconnect: 15,
+		EqualizeChargingVoltage: 14.2, BoostChargingVoltage: 14.2, FloatChargingVoltage: 13.8, BoostReconnectChargingVoltage: 13.2,
+		LowVoltageReconnectVoltage: 12.6, UnderVoltageWarningRecoverVoltage: 12.2, UnderVoltageWarningVoltage: 12,
+		LowVoltageDisconnectVoltage: 11.1, DischargingLimitVoltage: 10.6},
+	"flooded": {Nominal: 12, BatteryType: 0, TempCoef: 3,
+		OverVoltDisconnect: 16, ChargingLimitVoltage: 15, OverVoltageReconnect: 15,
+		EqualizeChargingVoltage: 14.8, BoostChargingVoltage: 14.6, FloatChargingVoltage: 13.8, BoostReconnectChargingVoltage: 13.2,
+		LowVoltageReconnectVoltage: 12.6, UnderVoltageWarningRecoverVoltage: 12.2, UnderVoltageWarningVoltage: 12,
+		LowVoltageDisconnectVoltage: 11.1, DischargingLimitVoltage: 10.6},
+	// 3.65V a cell at most, no equalization (equalize = boost) and no temperature compensation
+	"lifepo4-4s": {Nominal: 12, BatteryType: 0, TempCoef: 0,
+		OverVoltDisconnect: 14.8, ChargingLimitVoltage: 14.6, OverVoltageReconnect: 14.4,
+		EqualizeChargingVoltage: 14.4, BoostChargingVoltage: 14.4, FloatChargingVoltage: 13.6, BoostReconnectChargingVoltage: 13.2,
+		LowVoltageReconnectVoltage: 12.8, UnderVoltageWarningRecoverVoltage: 12.6, UnderVoltageWarningVoltage: 12.2,
+		LowVoltageDisconnectVoltage: 11.6, DischargingLimitVoltage: 11},
+	"lifepo4-8s": {Nominal: 24, BatteryType: 0, TempCoef: 0,
+		OverVoltDisconnect: 29.6, ChargingLimitVoltage: 29.2, OverVoltageReconnect: 28.8,
+		EqualizeChargingVoltage: 28.8, BoostChargingVoltage: 28.8, FloatChargingVoltage: 27.2, BoostReconnectChargingVoltage: 26.4,
+		LowVoltageReconnectVoltage: 25.6, UnderVoltageWarningRecoverVoltage: 25.2, UnderVoltageWarningVoltage: 24.4,
+		LowVoltageDisconnectVoltage: 23.2, DischargingLimitVoltage: 22},
+}
+
+// UnmarshalProfiles reads user defined profiles by name in "json" or "yaml".
+// Each must validate when applied at its own nominal voltage.
+func UnmarshalProfiles(data []byte, format string) (map[string]BatteryProfile, error) {
+	profiles := map[string]BatteryProfile{}
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, &profiles)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &profiles)
+	default:
+		err = fmt.Errorf("unknown profile format %q, want json or yaml", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, p := range profiles {
+		if _, err := p.Config(p.Nominal, 1); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return profiles, nil
+}
+
+// ProfileNames returns the names of the profiles, sorted
+func ProfileNames(profiles map[string]BatteryProfile) []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Config scales the profile to a system voltage and returns the complete,
+// validated battery settings for it. The capacity isn't part of a profile.
+func (p BatteryProfile) Config(systemVoltage float64, capacity uint16) (BatteryConfig, error) {
+	if p.Nominal <= 0 {
+		return BatteryConfig{}, fmt.Errorf("%w: profile has no nominal voltage", ErrInvalidConfig)
+	}
+	if systemVoltage <= 0 {
+		return BatteryConfig{}, fmt.Errorf("%w: no system voltage to scale the profile to", ErrInvalidConfig)
+	}
+	k := systemVoltage / p.Nominal
+	scale := func(v float64) float64 {
+		// Registers hold hundredths of a volt
+		return math.Round(v*k*100) / 100
+	}
+	c := BatteryConfig{
+		BatteryType:                       p.BatteryType,
+		Capacity:                          capacity,
+		TempCoef:                          p.TempCoef,
+		OverVoltDisconnect:                scale(p.OverVoltDisconnect),
+		ChargingLimitVoltage:              scale(p.ChargingLimitVoltage),
+		OverVoltageReconnect:              scale(p.OverVoltageReconnect),
+		EqualizeChargingVoltage:           scale(p.EqualizeChargingVoltage),
+		BoostChargingVoltage:              scale(p.BoostChargingVoltage),
+		FloatChargingVoltage:              scale(p.FloatChargingVoltage),
+		BoostReconnectChargingVoltage:     scale(p.BoostReconnectChargingVoltage),
+		LowVoltageReconnectVoltage:        scale(p.LowVoltageReconnectVoltage),
+		UnderVoltageWarningRecoverVoltage: scale(p.UnderVoltageWarningRecoverVoltage),
+		UnderVoltageWarningVoltage:        scale(p.UnderVoltageWarningVoltage),
+		LowVoltageDisconnectVoltage:       scale(p.LowVoltageDisconnectVoltage),
+		DischargingLimitVoltage:           scale(p.DischargingLimitVoltage),
+	}
+	return c, c.Validate()
+}
+
+// SystemVoltage is the battery system voltage set at 9067, false when the
+// controller recognizes it automatically
+func (s Snapshot) SystemVoltage() (float64, bool) {
+	v := s.BatteryConfigRatedVoltage.Amount()
+	return v, v > 0
+}
+
+// ratedVoltageBlock is the read plan for the system voltage setting
+var ratedVoltageBlock = planBlocks(registersIn(HoldingRegister, REGBatteryRatedVoltage, REGBatteryRatedVoltage))[0]
+
+// realRatedVoltageBlock is the read plan for the system voltage the
+// controller recognized from the battery
+var realRatedVoltageBlock = planBlocks(registersIn(InputRegister, REGBatteryRealRatedVoltage, REGBatteryRealRatedVoltage))[0]
+
+// ReadSystemVoltage reads the battery system voltage set at 9067, or when
+// that is Auto the voltage the controller recognized at 311d
+func (e *Epever) ReadSystemVoltage(ctx context.Context) (float64, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	if err := e.readBlock(ctx, ratedVoltageBlock, &e.snapshot); err != nil {
+		return 0, err
+	}
+	if v, ok := e.snapshot.SystemVoltage(); ok {
+		return v, nil
+	}
+	if err := e.readBlock(ctx, realRatedVoltageBlock, &e.snapshot); err != nil {
+		return 0, err
+	}
+	if v := e.snapshot.BatteryRealRatedVoltage; v > 0 {
+		return v, nil
+	}
+	return 0, fmt.Errorf("epever: system voltage is Auto and the controller hasn't recognized one")
+}
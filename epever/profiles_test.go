@@ -0,0 +1,79 @@
+package epever
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBuiltinProfiles(t *testing.T) {
+	for _, name := range ProfileNames(BuiltinProfiles) {
+		for _, volts := range []float64{12, 24, 48} {
+			if _, err := BuiltinProfiles[name].Config(volts, 200); err != nil {
+				t.Errorf("%s at %vV: %v", name, volts, err)
+			}
+		}
+	}
+
+	c, err := BuiltinProfiles["lifepo4-4s"].Config(48, 100)
+	if err != nil || c.BoostChargingVoltage != 57.6 || c.FloatChargingVoltage != 54.4 || c.Capacity != 100 {
+		t.Errorf("lifepo4-4s at 48V is %+v, %v", c, err)
+	}
+}
+
+func TestUnmarshalProfiles(t *testing.T) {
+	profiles, err := UnmarshalProfiles([]byte(`
+lto-6s:
+  nominal: 12
+  over_volt_disconnect: 17
+  charging_limit: 16.8
+  over_volt_reconnect: 16.2
+  equalize: 16.2
+  boost: 16.2
+  float: 15.6
+  boost_reconnect: 15
+  low_volt_reconnect: 13.8
+  under_volt_warning_recover: 13.6
+  under_volt_warning: 13.2
+  low_volt_disconnect: 12.6
+  discharging_limit: 12
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := profiles["lto-6s"].Config(24, 50); err != nil || c.BoostChargingVoltage != 32.4 {
+		t.Errorf("lto-6s at 24V is %+v, %v", c, err)
+	}
+
+	_, err = UnmarshalProfiles([]byte(`{"bad": {"nominal": 12, "boost": 14, "float": 15}}`), "json")
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected a profile breaking the rules to be refused, got %v", err)
+	}
+}
+
+func TestReadSystemVoltage(t *testing.T) {
+	slave := newFakeSlave(1)
+	slave.holding[REGBatteryRatedVoltage] = 2 // 24V
+	slave.input[REGBatteryRealRatedVoltage] = 4800
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	ctx := context.Background()
+
+	if v, err := ep.ReadSystemVoltage(ctx); err != nil || v != 24 {
+		t.Errorf("set to 24V reads %v, %v", v, err)
+	}
+
+	// Auto falls back to the voltage the controller recognized
+	slave.holding[REGBatteryRatedVoltage] = 0
+	if v, err := ep.ReadSystemVoltage(ctx); err != nil || v != 48 {
+		t.Errorf("auto reads %v, %v, want the recognized 48V", v, err)
+	}
+
+	slave.input[REGBatteryRealRatedVoltage] = 0
+	if v, err := ep.ReadSystemVoltage(ctx); err == nil {
+		t.Errorf("auto with nothing recognized reads %v", v)
+	}
+}
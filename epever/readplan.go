@@ -0,0 +1,95 @@
+package epever
+
+import (
+	"context"
+
+	"github.com/goburrow/modbus"
+)
+
+// On a 9600 baud link every request costs a round trip of tens of
+// milliseconds before any data moves, while a register costs two bytes, about
+// 2ms. Reads are therefore merged across small gaps of registers nobody asked
+// for, within these limits.
+const (
+	maxReadGap       = 8   // Most unwanted registers spanned by a merged read
+	maxReadRegisters = 125 // Largest register read that fits a modbus frame
+	maxReadBits      = 2000
+)
+
+// coalesce merges nearby blocks of a read plan into fewer, larger reads. A
+// merged read stays within one table and one 0x100 page of it: the controller
+// keeps its ratings, readings, status, statistics and settings in separate
+// pages (0x30xx, 0x31xx, 0x32xx, 0x33xx, 0x90xx) and won't answer a read that
+// crosses between them. The blocks merged are kept as its parts, to fall back
+// on if the device refuses the gaps. Only reads can be merged: a write over a
+// gap would overwrite registers the caller never meant to touch.
+func coalesce(blocks []block) []block {
+	var merged []block
+	for _, b := range blocks {
+		if n := len(merged); n > 0 && mergeable(merged[n-1], b) {
+			m := &merged[n-1]
+			if len(m.parts) == 0 {
+				m.parts = []block{*m}
+			}
+			m.parts = append(m.parts, b)
+			m.regs = append(append([]Register{}, m.regs...), b.regs...)
+			m.quantity = b.address + b.quantity - m.address
+			continue
+		}
+		merged = append(merged, b)
+	}
+	return merged
+}
+
+// mergeable says if one read can cover block a and the block b following it
+func mergeable(a, b block) bool {
+	if a.table != b.table || a.address>>8 != b.address>>8 || b.address < a.address+a.quantity {
+		return false
+	}
+	gap := b.address - (a.address + a.quantity)
+	quantity := b.address + b.quantity - a.address
+	if a.table == Coil || a.table == DiscreteInput {
+		// Bits are packed, so a gap costs 16 times less than in registers
+		return gap <= 16*maxReadGap && quantity <= maxReadBits
+	}
+	return gap <= maxReadGap && quantity <= maxReadRegisters
+}
+
+// blockKey identifies a merged read
+type blockKey struct {
+	table   Table
+	address uint16
+}
+
+// readBlocks reads and decodes the blocks of a plan into the snapshot.
+// Caller must hold the bus mutex.
+func (e *Epever) readBlocks(ctx context.Context, blocks []block, s *Snapshot) error {
+	for _, b := range blocks {
+		if err := e.readBlock(ctx, b, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlock reads one block. If the device says a merged read spans an
+// address it doesn't have, its parts are read separately instead, now and
+// from then on.
+func (e *Epever) readBlock(ctx context.Context, b block, s *Snapshot) error {
+	key := blockKey{b.table, b.address}
+	if len(b.parts) == 0 || !e.split[key] {
+		data, err := e.readTable(ctx, b.table, b.address, b.quantity)
+		if err == nil {
+			b.decode(s, data)
+			return nil
+		}
+		if code, ok := exceptionCode(err); len(b.parts) == 0 || !ok || code != modbus.ExceptionCodeIllegalDataAddress {
+			return err
+		}
+		if e.split == nil {
+			e.split = map[blockKey]bool{}
+		}
+		e.split[key] = true
+	}
+	return e.readBlocks(ctx, b.parts, s)
+}
@@ -0,0 +1,127 @@
+package epever
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCoalesce(t *testing.T) {
+	planned := planBlocks(Registers)
+	merged := coalesce(planned)
+	if len(merged) >= len(planned) {
+		t.Fatalf("coalescing %d blocks left %d", len(planned), len(merged))
+	}
+
+	covered := 0
+	for _, b := range merged {
+		if last := b.address + b.quantity - 1; last>>8 != b.address>>8 {
+			t.Errorf("%s 0x%04x+%d crosses a page", b.table, b.address, b.quantity)
+		}
+		if b.quantity > maxReadRegisters {
+			t.Errorf("%s 0x%04x+%d is too long for a frame", b.table, b.address, b.quantity)
+		}
+		for _, r := range b.regs {
+			if r.Address < b.address || r.Address+r.words() > b.address+b.quantity {
+				t.Errorf("%s is outside %s 0x%04x+%d", r.Name, b.table, b.address, b.quantity)
+			}
+		}
+		covered += len(b.regs)
+	}
+	if covered != len(Registers) {
+		t.Errorf("merged blocks cover %d registers, want %d", covered, len(Registers))
+	}
+
+	// The single register reads of the readings and settings are merged away
+	for _, single := range []struct {
+		table   Table
+		address uint16
+	}{
+		{InputRegister, REGBatteryPercent},
+		{InputRegister, REGBatteryRealRatedVoltage},
+		{HoldingRegister, REGLengthOfNight},
+		{HoldingRegister, REGDefaultLoadManual},
+	} {
+		for _, b := range merged {
+			if b.table == single.table && b.address == single.address && b.quantity == 1 {
+				t.Errorf("%s 0x%04x is still read on its own", single.table, single.address)
+			}
+		}
+	}
+}
+
+func TestReadFallback(t *testing.T) {
+	// A slave without the registers in the gaps refuses the merged reads
+	slave := newFakeSlave(1)
+	slave.fill(planBlocks(Registers))
+	slave.input[REGBatteryPercent] = 87
+	slave.holding[REGDefaultLoadManual] = 1
+
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+
+	s, err := ep.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.BatteryPercent != 87 || !s.LoadDefaultOn {
+		t.Errorf("read battery %v%% default on %v through the fallback", s.BatteryPercent, s.LoadDefaultOn)
+	}
+
+	// Once refused, a merged read isn't tried again
+	slave.mu.Lock()
+	slave.requests = 0
+	slave.mu.Unlock()
+	if _, err := ep.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := 0
+	for _, b := range refreshBlocks {
+		if ep.split[blockKey{b.table, b.address}] {
+			want += len(b.parts)
+		} else {
+			want++
+		}
+	}
+	if len(ep.split) == 0 || slave.requests != want {
+		t.Errorf("second refresh made %d requests with %d reads split, want %d", slave.requests, len(ep.split), want)
+	}
+}
+
+// BenchmarkRefresh reads the whole register map from a controller on a
+// simulated 9600 baud link, one request per contiguous block and coalesced
+func BenchmarkRefresh(b *testing.B) {
+	slave := newFakeSlave(1)
+	slave.fill(refreshBlocks)
+	slave.baud = 9600
+
+	for _, plan := range []struct {
+		name   string
+		blocks []block
+	}{
+		{"contiguous", planBlocks(Registers)},
+		{"coalesced", refreshBlocks},
+	} {
+		b.Run(plan.name, func(b *testing.B) {
+			ep, err := NewEpever("tcp://" + slave.serveTCP(b))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer ep.Close()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var s Snapshot
+				ep.bus.mu.Lock()
+				err := ep.readBlocks(context.Background(), plan.blocks, &s)
+				ep.bus.mu.Unlock()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(plan.blocks)), "requests/op")
+		})
+	}
+}
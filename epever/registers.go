@@ -0,0 +1,195 @@
+package epever
+
+// ====
+// 30xx
+const REGRatedInputVoltage = 0x3000
+const REGRatedInputCurrent = 0x3001
+const REGRatedInputPowerL = 0x3002
+const REGRatedInputPowerH = 0x3003
+
+const REGRatedBatteryVoltage = 0x3004
+const REGRatedBatteryCurrent = 0x3005
+const REGRatedBatteryPowerL = 0x3006
+const REGRatedBatteryPowerH = 0x3007
+
+//const REGChargingMode = 0x3008
+
+// 3009
+// 300a
+// 300b
+// 300c
+//const REGRatedLoadVoltage = 0x300d
+//const REGRatedLoadCurrent = 0x300e
+//const REGRatedLoadPowerL = 0x300f
+//const REGRatedLoadPowerH = 0x3010
+
+// ====
+// 31xx
+const REGChargeVoltage = 0x3100
+const REGChargeCurrent = 0x3101
+const REGChargePowerL = 0x3102
+const REGChargePowerH = 0x3103
+
+const REGBatteryVoltage = 0x3104
+const REGBatteryCurrent = 0x3105 // signed, negative while discharging
+const REGBatteryPowerL = 0x3106
+const REGBatteryPowerH = 0x3107
+
+// 3108
+// 3109
+// 310a
+// 310b
+const REGLoadVoltage = 0x310c
+const REGLoadCurrent = 0x310d
+const REGLoadPowerL = 0x310e
+const REGLoadPowerH = 0x310f
+
+// Temperatures are signed, in 1/100 C
+const REGTempBattery = 0x3110
+const REGTempInside = 0x3111
+const REGTempHeatsink = 0x3112
+
+// 3113
+// 3114
+// 3115
+// 3116
+// 3117
+// 3118
+// 3119
+const REGBatteryPercent = 0x311a
+const REGTempRemoteBattery = 0x311b // signed
+
+// 311c
+const REGBatteryRealRatedVoltage = 0x311d // recognised from the battery, 12/24/36/48V
+
+//const REGTempAmbient = 0x311e
+
+// 311f
+
+// ====
+// 32xx
+const REGBatteryStatus = 0x3200
+const REGChargingStatus = 0x3201
+const REGDischargingStatus = 0x3202
+
+// Discharging status 3202
+//  D15-D14 input voltage: 00 normal, 01 low, 10 high, 11 no access (input volt error)
+//  D13-D12 output power: 00 light load, 01 moderate, 10 rated, 11 overload
+//  D11 short circuit
+//  D10 unable to discharge
+//  D9  unable to stop discharging
+//  D8  output voltage abnormal
+//  D7  input overvoltage
+//  D6  high voltage side short circuit
+//  D5  boost overvoltage
+//  D4  output overvoltage
+//  D1  0 normal, 1 fault
+//  D0  1 running, 0 standby
+
+// ====
+// 33xx
+const REGBatteryVoltageTodayMax = 0x3302
+const REGBatteryVoltageTodayMin = 0x3303
+const REGConsumedTodayL = 0x3304
+const REGConsumedTodayH = 0x3305
+const REGConsumedMonthL = 0x3306
+const REGConsumedMonthH = 0x3307
+const REGConsumedYearL = 0x3308
+const REGConsumedYearH = 0x3309
+const REGConsumedL = 0x330a
+const REGConsumedH = 0x330b
+const REGGeneratedTodayL = 0x330c
+const REGGeneratedTodayH = 0x330d
+const REGGeneratedMonthL = 0x330e
+const REGGeneratedMonthH = 0x330f
+const REGGeneratedYearL = 0x3310
+const REGGeneratedYearH = 0x3311
+const REGGeneratedL = 0x3312
+const REGGeneratedH = 0x3313
+
+const REGBatteryNetVoltage = 0x331a
+const REGBatteryNetCurrentL = 0x331b
+const REGBatteryNetCurrentH = 0x331c
+
+// Holding registers
+const REGBatteryType = 0x9000
+const REGBatteryCapacity = 0x9001 // AH
+const REGBatteryTempCoef = 0x9002
+const REGBatteryOverVoltageDisconnect = 0x9003
+const REGBatteryChargingLimitVoltage = 0x9004
+const REGBatteryOverVoltageReconnect = 0x9005
+const REGBatteryEqualizeChargingVoltage = 0x9006
+const REGBatteryBoostChargingVoltage = 0x9007
+const REGBatteryFloatChargingVoltage = 0x9008
+const REGBatteryBoostReconnectChargingVoltage = 0x9009
+const REGBatteryLowVoltageReconnectVoltage = 0x900a
+const REGBatteryUnderVoltageWarningRecoverVoltage = 0x900b
+const REGBatteryUnderVoltageWarningVoltage = 0x900c
+const REGBatteryLowVoltageDisconnectVoltage = 0x900d
+const REGBatteryDischargingLimitVoltage = 0x900e
+
+const REGBatteryRatedVoltage = 0x9067 // 0 auto, 1 12V, 2 24V, 3 36V, 4 48V, 5 60V, 6 110V, 7 120V, 8 220V, 9 240V
+const REGBatteryEqualizeDuration = 0x906b
+const REGBatteryBoostDuration = 0x906c
+const REGBatteryDischarge = 0x906d    // Depth of discharge, 20-80%
+const REGBatteryChargeDepth = 0x906e  // Depth of charge, 20-100%
+const REGBatteryChargingMode = 0x9070 // Battery management mode, 0 voltage compensation, 1 SOC
+
+// Temperature limits
+const REGBatteryTempWarningUpperLimit = 0x9017
+const REGBatteryTempWarningLowerLimit = 0x9018
+const REGControllerInnerTempUpperLimit = 0x9019
+const REGControllerInnerTempUpperLimitRecover = 0x901a
+const REGPowerComponentTempUpperLimit = 0x901b
+const REGPowerComponentTempUpperLimitRecover = 0x901c
+const REGLineImpedance = 0x901d // milliohm
+
+const REGBatteryEqualizePeriodDays = 0x9016
+
+// RTC
+const REGRTCSecMin = 0x9013
+const REGRTCHourDay = 0x9014
+const REGRTCMonthYear = 0x9015
+
+// Load control
+const REGNightTimeThresholdVolt = 0x901e // PV voltage below which it is night
+const REGLightOnDelay = 0x901f           // Minutes below the night threshold before the light comes on
+const REGDayTimeThresholdVolt = 0x9020   // PV voltage above which it is day
+const REGLightOffDelay = 0x9021          // Minutes above the day threshold before the light goes off
+// 9022 is listed with the thresholds by some tools but isn't in the protocol document, so it isn't read
+
+const REGLoadControlMode = 0x903d  // 0 manual, 1 light on/off, 2 light on + timer, 3 time control
+const REGLoadWorkingTime1 = 0x903e // Length of load output timer 1, hour in the high byte, minute in the low
+const REGLoadWorkingTime2 = 0x903f
+
+const REGLoadTurnOn1Sec = 0x9042
+const REGLoadTurnOn1Min = 0x9043
+const REGLoadTurnOn1Hour = 0x9044
+const REGLoadTurnOff1Sec = 0x9045
+const REGLoadTurnOff1Min = 0x9046
+const REGLoadTurnOff1Hour = 0x9047
+const REGLoadTurnOn2Sec = 0x9048
+const REGLoadTurnOn2Min = 0x9049
+const REGLoadTurnOn2Hour = 0x904a
+const REGLoadTurnOff2Sec = 0x904b
+const REGLoadTurnOff2Min = 0x904c
+const REGLoadTurnOff2Hour = 0x904d
+
+const REGLengthOfNight = 0x9065       // Hour in the high byte, minute in the low
+const REGLoadTimingSelection = 0x9069 // 0 one timer, 1 two timers
+const REGDefaultLoadManual = 0x906a   // Load state in manual mode, 0 off, 1 on
+
+// ====
+// Discrete inputs
+const DISOverTemp = 0x2000 // 1 the temperature inside the controller is higher than the over-temperature protection point
+const DISDayNight = 0x200c // 1 night, 0 day
+
+// ====
+// Coils
+const COILChargingDeviceOnOff = 0x0000 // 1 on, 0 off
+const COILOutputControlMode = 0x0001   // 1 manual, 0 automatic
+const COILManualLoadControl = 0x0002   // 1 on, 0 off, only in manual output control mode
+const COILDefaultLoadControl = 0x0003  // Load state in manual mode after power up, 1 on, 0 off
+// 0004
+const COILLoadTestMode = 0x0005 // 1 enable, 0 disable (normal)
+const COILForceLoad = 0x0006    // 1 on, 0 off, only in load test mode
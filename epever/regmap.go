@@ -0,0 +1,453 @@
+package epever
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Table is the modbus table a register lives in
+type Table int
+
+const (
+	InputRegister Table = iota
+	HoldingRegister
+	Coil
+	DiscreteInput
+)
+
+func (me Table) String() string {
+	return [...]string{"input", "holding", "coil", "discrete"}[me]
+}
+
+// Register describes one value on the controller and where it ends up.
+// Several entries may share an address when each decodes a bit field of it.
+type Register struct {
+	Name    string // Snapshot field the value is decoded into
+	Address uint16
+	Table   Table
+	Words   int     // 1 or 2, 32 bit values are sent low word first. 0 means 1
+	Signed  bool    // Two's complement over the whole width
+	Scale   float64 // The raw value is divided by this. 0 means 1
+	Shift   uint    // For bit fields the value is (raw >> Shift) & Mask
+	Mask    uint16
+	Unit    string
+	Group   string // Line of String() output the value is shown on, empty to hide it
+	Label   string // Shown before the value, or alone for a true flag
+	Metric  string // Prometheus metric name, empty if not exported. Counters end in _total.
+	Legacy  string // Name the metric had before it followed the Prometheus conventions
+	Help    string
+
+	// For enums, a state set metric with a series per state named by String(),
+	// 1 for the current state and 0 for the rest
+	StateSet string
+}
+
+// Registers is the register map for the Tracer series. Refresh reads and
+// decodes every entry, in this order.
+var Registers = []Register{
+	{Name: "RatedInputVoltage", Address: REGRatedInputVoltage, Scale: 100, Unit: "V", Group: "Rated input", Metric: "solar_rated_input_volts", Legacy: "solar_rated_input_voltage", Help: "Rated input voltage"},
+	{Name: "RatedInputCurrent", Address: REGRatedInputCurrent, Scale: 100, Unit: "A", Group: "Rated input", Metric: "solar_rated_input_amperes", Legacy: "solar_rated_input_current", Help: "Rated input current"},
+	{Name: "RatedInputPower", Address: REGRatedInputPowerL, Words: 2, Scale: 100, Unit: "W", Group: "Rated input", Metric: "solar_rated_input_watts", Legacy: "solar_rated_input_power", Help: "Rated input power"},
+	{Name: "RatedBatteryVoltage", Address: REGRatedBatteryVoltage, Scale: 100, Unit: "V", Group: "Rated battery", Metric: "solar_rated_battery_volts", Help: "Rated battery voltage"},
+	{Name: "RatedBatteryCurrent", Address: REGRatedBatteryCurrent, Scale: 100, Unit: "A", Group: "Rated battery", Metric: "solar_rated_battery_amperes", Help: "Rated battery current"},
+	{Name: "RatedBatteryPower", Address: REGRatedBatteryPowerL, Words: 2, Scale: 100, Unit: "W", Group: "Rated battery", Metric: "solar_rated_battery_watts", Help: "Rated battery power"},
+	{Name: "BatteryRealRatedVoltage", Address: REGBatteryRealRatedVoltage, Scale: 100, Unit: "V", Group: "Rated battery", Label: "recognised ", Metric: "solar_battery_real_rated_volts", Help: "Battery system voltage recognised by the controller"},
+
+	{Name: "ChargeVoltage", Address: REGChargeVoltage, Scale: 100, Unit: "V", Group: "Charge", Metric: "solar_pv_volts", Legacy: "solar_pv_voltage", Help: "PV array voltage"},
+	{Name: "ChargeCurrent", Address: REGChargeCurrent, Scale: 100, Unit: "A", Group: "Charge", Metric: "solar_pv_amperes", Legacy: "solar_pv_current", Help: "PV array current"},
+	{Name: "ChargePower", Address: REGChargePowerL, Words: 2, Scale: 100, Unit: "W", Group: "Charge", Metric: "solar_pv_watts", Legacy: "solar_pv_power", Help: "PV array power"},
+	{Name: "StatusCharging", Address: REGChargingStatus},
+	{Name: "StatusChargingStatus", Address: REGChargingStatus, Shift: 2, Mask: 0b11, Group: "Charge", Metric: "solar_status_charging_status", Legacy: "status_charging_status", StateSet: "solar_charging_state", Help: "Status Charging Status"},
+	{Name: "StatusChargingInputVoltStatus", Address: REGChargingStatus, Shift: 14, Mask: 0b11, Group: "Charge", Metric: "solar_status_charging_input_volt_status", Legacy: "status_charging_input_volt_status", StateSet: "solar_charging_input_voltage_state", Help: "Status Charging Input Volt Status"},
+	{Name: "Night", Address: DISDayNight, Table: DiscreteInput, Group: "Charge", Label: "Night", Metric: "solar_night", Help: "Controller sees night"},
+	{Name: "StatusChargingRunning", Address: REGChargingStatus, Shift: 0, Mask: 1, Group: "Charge", Label: "Running", Metric: "solar_status_charging_running", Legacy: "status_charging_running", Help: "Status Charging Running"},
+	{Name: "StatusChargingLoadOpenCircuit", Address: REGChargingStatus, Shift: 5, Mask: 1, Group: "Charge", Label: "LoadOpenCircuit", Metric: "solar_status_charging_load_open_circuit", Legacy: "status_charging_load_open_circuit", Help: "Status Charging Load Open Circuit"},
+	{Name: "StatusChargingLoadMosfetShort", Address: REGChargingStatus, Shift: 7, Mask: 1, Group: "Charge", Label: "LoadMosfetShort", Metric: "solar_status_charging_load_mosfet_short", Legacy: "status_charging_load_mosfet_short", Help: "Status Charging Load Mosfet Short"},
+	{Name: "StatusChargingLoadShort", Address: REGChargingStatus, Shift: 8, Mask: 1, Group: "Charge", Label: "LoadShort", Metric: "solar_status_charging_load_short", Legacy: "status_charging_load_short", Help: "Status Charging Load Short"},
+	{Name: "StatusChargingLoadOverCurrent", Address: REGChargingStatus, Shift: 9, Mask: 1, Group: "Charge", Label: "LoadOverCurrent", Metric: "solar_status_charging_load_over_current", Legacy: "status_charging_load_over_current", Help: "Status Charging Load Over Current"},
+	{Name: "StatusChargingInputOverCurrent", Address: REGChargingStatus, Shift: 10, Mask: 1, Group: "Charge", Label: "InputOverCurrent", Metric: "solar_status_charging_input_over_current", Legacy: "status_charging_input_over_current", Help: "Status Charging Input Over Current"},
+	{Name: "StatusChargingAntiReverseMosfetShort", Address: REGChargingStatus, Shift: 11, Mask: 1, Group: "Charge", Label: "AntiReverseMosfetShort", Metric: "solar_status_charging_anti_reverse_mosfet_short", Legacy: "status_charging_anti_reverse_mosfet_short", Help: "Status Charging Anti Reverse Mosfet Short"},
+	{Name: "StatusChargingOrAntiReverseMosfetShort", Address: REGChargingStatus, Shift: 12, Mask: 1, Group: "Charge", Label: "ChargingOrAntiReverseMosfetShort", Metric: "solar_status_charging_or_anti_reverse_mosfet_short", Legacy: "status_charging_or_anti_reverse_mosfet_short", Help: "Status Charging Or Anit Reverse Mosfet Short"},
+	{Name: "StatusChargingMosfetShort", Address: REGChargingStatus, Shift: 13, Mask: 1, Group: "Charge", Label: "ChargingMosfetShort", Metric: "solar_status_charging_mosfet_short", Legacy: "status_charging_mosfet_short", Help: "Status Charging Mosfet Short"},
+
+	{Name: "BatteryVoltage", Address: REGBatteryVoltage, Scale: 100, Unit: "V", Group: "Battery", Metric: "solar_battery_volts", Legacy: "solar_bat_voltage", Help: "Battery array voltage"},
+	{Name: "BatteryCurrent", Address: REGBatteryCurrent, Signed: true, Scale: 100, Unit: "A", Group: "Battery", Metric: "solar_battery_amperes", Legacy: "solar_bat_current", Help: "Battery array current"},
+	{Name: "BatteryPower", Address: REGBatteryPowerL, Words: 2, Scale: 100, Unit: "W", Group: "Battery", Metric: "solar_battery_watts", Legacy: "solar_bat_power", Help: "Battery array power"},
+	{Name: "BatteryPercent", Address: REGBatteryPercent, Unit: "%", Group: "Battery", Metric: "solar_battery_charge_ratio", Legacy: "solar_battery_percent", Help: "Battery percent"},
+	{Name: "StatusBattery", Address: REGBatteryStatus},
+	{Name: "StatusBatteryTemp", Address: REGBatteryStatus, Shift: 4, Mask: 0b1111, Group: "Battery", Metric: "solar_status_battery_temp", Legacy: "status_battery_temp", StateSet: "solar_battery_temperature_state", Help: "Status Battery Temp"},
+	{Name: "StatusBatteryVolt", Address: REGBatteryStatus, Shift: 0, Mask: 0b1111, Group: "Battery", Metric: "solar_status_battery_volt", Legacy: "status_battery_volt", StateSet: "solar_battery_voltage_state", Help: "Status Battery Voltage"},
+	{Name: "StatusBatteryResistanceAbnormal", Address: REGBatteryStatus, Shift: 8, Mask: 1, Group: "Battery", Label: "ResAbnormal", Metric: "solar_status_battery_resistance_abnormal", Legacy: "status_battery_resistance_abnormal", Help: "Status Battery Resistance Abnormal"},
+	{Name: "StatusBatteryWrongID", Address: REGBatteryStatus, Shift: 15, Mask: 1, Group: "Battery", Label: "WrongID", Metric: "solar_status_battery_wrong_id", Legacy: "status_battery_wrong_id", Help: "Status Battery Wrong ID"},
+
+	{Name: "BatteryNetVoltage", Address: REGBatteryNetVoltage, Scale: 100, Unit: "V", Group: "Battery net", Metric: "solar_battery_net_volts", Legacy: "solar_battery_net_voltage", Help: "Battery net voltage"},
+	{Name: "BatteryNetCurrent", Address: REGBatteryNetCurrentL, Words: 2, Signed: true, Scale: 100, Unit: "A", Group: "Battery net", Metric: "solar_battery_net_amperes", Legacy: "solar_battery_net_current", Help: "Battery net current"},
+	{Name: "HistBatteryVoltageTodayMin", Address: REGBatteryVoltageTodayMin, Scale: 100, Unit: "V", Group: "Battery net", Label: "dayMin "},
+	{Name: "HistBatteryVoltageTodayMax", Address: REGBatteryVoltageTodayMax, Scale: 100, Unit: "V", Group: "Battery net", Label: "dayMax "},
+
+	{Name: "LoadVoltage", Address: REGLoadVoltage, Scale: 100, Unit: "V", Group: "Load", Metric: "solar_load_volts", Legacy: "solar_load_voltage", Help: "Load voltage"},
+	{Name: "LoadCurrent", Address: REGLoadCurrent, Scale: 100, Unit: "A", Group: "Load", Metric: "solar_load_amperes", Legacy: "solar_load_current", Help: "Load current"},
+	{Name: "LoadPower", Address: REGLoadPowerL, Words: 2, Scale: 100, Unit: "W", Group: "Load", Metric: "solar_load_watts", Legacy: "solar_load_power", Help: "Load power"},
+	{Name: "StatusDischarging", Address: REGDischargingStatus},
+	{Name: "StatusDischargingInputVoltStatus", Address: REGDischargingStatus, Shift: 14, Mask: 0b11, Group: "Load", Metric: "solar_status_discharging_input_volt_status", StateSet: "solar_discharging_input_voltage_state", Help: "Status Discharging Input Volt Status"},
+	{Name: "StatusDischargingOutputPower", Address: REGDischargingStatus, Shift: 12, Mask: 0b11, Group: "Load", Metric: "solar_status_discharging_output_power", StateSet: "solar_discharging_output_power_state", Help: "Status Discharging Output Power"},
+	{Name: "StatusDischargingRunning", Address: REGDischargingStatus, Shift: 0, Mask: 1, Group: "Load", Label: "Running", Metric: "solar_status_discharging_running", Help: "Status Discharging Running"},
+	{Name: "StatusDischargingFault", Address: REGDischargingStatus, Shift: 1, Mask: 1, Group: "Load", Label: "Fault", Metric: "solar_status_discharging_fault", Help: "Status Discharging Fault"},
+	{Name: "StatusDischargingOutputOverVoltage", Address: REGDischargingStatus, Shift: 4, Mask: 1, Group: "Load", Label: "OutputOverVoltage", Metric: "solar_status_discharging_output_over_voltage", Help: "Status Discharging Output Over Voltage"},
+	{Name: "StatusDischargingBoostOverVoltage", Address: REGDischargingStatus, Shift: 5, Mask: 1, Group: "Load", Label: "BoostOverVoltage", Metric: "solar_status_discharging_boost_over_voltage", Help: "Status Discharging Boost Over Voltage"},
+	{Name: "StatusDischargingHighVoltageSideShort", Address: REGDischargingStatus, Shift: 6, Mask: 1, Group: "Load", Label: "HighVoltageSideShort", Metric: "solar_status_discharging_high_voltage_side_short", Help: "Status Discharging High Voltage Side Short"},
+	{Name: "StatusDischargingInputOverVoltage", Address: REGDischargingStatus, Shift: 7, Mask: 1, Group: "Load", Label: "InputOverVoltage", Metric: "solar_status_discharging_input_over_voltage", Help: "Status Discharging Input Over Voltage"},
+	{Name: "StatusDischargingOutputVoltAbnormal", Address: REGDischargingStatus, Shift: 8, Mask: 1, Group: "Load", Label: "OutputVoltAbnormal", Metric: "solar_status_discharging_output_volt_abnormal", Help: "Status Discharging Output Voltage Abnormal"},
+	{Name: "StatusDischargingUnableToStop", Address: REGDischargingStatus, Shift: 9, Mask: 1, Group: "Load", Label: "UnableToStop", Metric: "solar_status_discharging_unable_to_stop", Help: "Status Discharging Unable To Stop Discharging"},
+	{Name: "StatusDischargingUnableToDischarge", Address: REGDischargingStatus, Shift: 10, Mask: 1, Group: "Load", Label: "UnableToDischarge", Metric: "solar_status_discharging_unable_to_discharge", Help: "Status Discharging Unable To Discharge"},
+	{Name: "StatusDischargingShortCircuit", Address: REGDischargingStatus, Shift: 11, Mask: 1, Group: "Load", Label: "ShortCircuit", Metric: "solar_status_discharging_short_circuit", Help: "Status Discharging Short Circuit"},
+
+	{Name: "TempBattery", Address: REGTempBattery, Signed: true, Scale: 100, Unit: "C", Group: "Temp", Label: "battery:", Metric: "solar_battery_temperature_celsius", Legacy: "solar_temp_battery", Help: "Temperature battery"},
+	{Name: "TempInside", Address: REGTempInside, Signed: true, Scale: 100, Unit: "C", Group: "Temp", Label: "inside:", Metric: "solar_inside_temperature_celsius", Legacy: "solar_temp_inside", Help: "Temperature inside"},
+	{Name: "TempHeatsink", Address: REGTempHeatsink, Signed: true, Scale: 100, Unit: "C", Group: "Temp", Label: "heatsink:", Metric: "solar_heatsink_temperature_celsius", Legacy: "solar_temp_heatsink", Help: "Temperature heatsink"},
+	{Name: "TempRemoteBattery", Address: REGTempRemoteBattery, Signed: true, Scale: 100, Unit: "C", Group: "Temp", Label: "remote:", Metric: "solar_remote_battery_temperature_celsius", Legacy: "solar_temp_remote_battery", Help: "Temperature remote battery"},
+	{Name: "OverTemp", Address: DISOverTemp, Table: DiscreteInput, Group: "Temp", Label: "OverTemp", Metric: "solar_over_temperature", Help: "Temperature inside the controller above its over temperature protection point"},
+
+	{Name: "HistConsumedToday", Address: REGConsumedTodayL, Words: 2, Scale: 100, Unit: "kWh", Group: "Consumed", Label: "day ", Metric: "solar_consumed_today_kilowatt_hours", Legacy: "solar_consumed_today", Help: "Consumed today"},
+	{Name: "HistConsumedMonth", Address: REGConsumedMonthL, Words: 2, Scale: 100, Unit: "kWh", Group: "Consumed", Label: "month ", Metric: "solar_consumed_month_kilowatt_hours", Legacy: "solar_consumed_month", Help: "Consumed month"},
+	{Name: "HistConsumedYear", Address: REGConsumedYearL, Words: 2, Scale: 100, Unit: "kWh", Group: "Consumed", Label: "year ", Metric: "solar_consumed_year_kilowatt_hours", Legacy: "solar_consumed_year", Help: "Consumed year"},
+	{Name: "HistConsumed", Address: REGConsumedL, Words: 2, Scale: 100, Unit: "kWh", Group: "Consumed", Label: "total ", Metric: "solar_consumed_kilowatt_hours_total", Legacy: "solar_consumed_total", Help: "Consumed total"},
+	{Name: "HistGeneratedToday", Address: REGGeneratedTodayL, Words: 2, Scale: 100, Unit: "kWh", Group: "Generated", Label: "day ", Metric: "solar_generated_today_kilowatt_hours", Legacy: "solar_generated_today", Help: "Generated today"},
+	{Name: "HistGeneratedMonth", Address: REGGeneratedMonthL, Words: 2, Scale: 100, Unit: "kWh", Group: "Generated", Label: "month ", Metric: "solar_generated_month_kilowatt_hours", Legacy: "solar_generated_month", Help: "Generated month"},
+	{Name: "HistGeneratedYear", Address: REGGeneratedYearL, Words: 2, Scale: 100, Unit: "kWh", Group: "Generated", Label: "year ", Metric: "solar_generated_year_kilowatt_hours", Legacy: "solar_generated_year", Help: "Generated year"},
+	{Name: "HistGenerated", Address: REGGeneratedL, Words: 2, Scale: 100, Unit: "kWh", Group: "Generated", Label: "total ", Metric: "solar_generated_kilowatt_hours_total", Legacy: "solar_generated_total", Help: "Generated total"},
+
+	{Name: "BatteryConfigBatteryType", Address: REGBatteryType, Table: HoldingRegister, Group: "Battery config", Label: "type(USR/SEAL/GEL/FLOOD) "},
+	{Name: "BatteryConfigCapacity", Address: REGBatteryCapacity, Table: HoldingRegister, Unit: "Ah", Group: "Battery config", Label: "capacity "},
+	{Name: "BatteryConfigTempCoef", Address: REGBatteryTempCoef, Table: HoldingRegister, Scale: 100, Unit: "mV/C/2V", Group: "Battery config", Label: "tempCoef "},
+	{Name: "BatteryConfigOverVoltDisconnect", Address: REGBatteryOverVoltageDisconnect, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "overVoltDisconnect ", Metric: "solar_battery_config_over_voltage_disconnect_volts", Legacy: "solar_battery_config_over_voltage_disconnect", Help: "Config Over Voltage Disconnect"},
+	{Name: "BatteryConfigChargingLimitVoltage", Address: REGBatteryChargingLimitVoltage, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "chargingLimit ", Metric: "solar_battery_config_charging_limit_volts", Legacy: "solar_battery_config_charging_limit_voltage", Help: "Config Charging Limit Voltage"},
+	{Name: "BatteryConfigOverVoltageReconnect", Address: REGBatteryOverVoltageReconnect, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "overVoltReconnect ", Metric: "solar_battery_config_over_voltage_reconnect_volts", Legacy: "solar_battery_config_over_voltage_reconnect", Help: "Config Over Voltage Reconnect"},
+	{Name: "BatteryConfigEqualizeChargingVoltage", Address: REGBatteryEqualizeChargingVoltage, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "equalize ", Metric: "solar_battery_config_equalize_charging_volts", Legacy: "solar_battery_config_equalize_charging_voltage", Help: "Config Equalize Charging Voltage"},
+	{Name: "BatteryConfigBoostChargingVoltage", Address: REGBatteryBoostChargingVoltage, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "boost ", Metric: "solar_battery_config_boost_charging_volts", Legacy: "solar_battery_config_boost_charging_voltage", Help: "Config Boost Charging Voltage"},
+	{Name: "BatteryConfigFloatChargingVoltage", Address: REGBatteryFloatChargingVoltage, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "float ", Metric: "solar_battery_config_float_charging_volts", Legacy: "solar_battery_config_float_charging_voltage", Help: "Config Float Charging Voltage"},
+	{Name: "BatteryConfigBoostReconnectChargingVoltage", Address: REGBatteryBoostReconnectChargingVoltage, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "boostReconnect ", Metric: "solar_battery_config_boost_reconnect_charging_volts", Legacy: "solar_battery_config_boost_reconnect_charging_voltage", Help: "Config Boost Reconnect Charging Voltage"},
+	{Name: "BatteryConfigLowVoltageReconnectVoltage", Address: REGBatteryLowVoltageReconnectVoltage, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "lowVoltReconnect ", Metric: "solar_battery_config_low_voltage_reconnect_volts", Legacy: "solar_battery_config_low_voltage_reconnect_voltage", Help: "Config Low Voltage Reconnect Voltage"},
+	{Name: "BatteryConfigUnderVoltageWarningRecoverVoltage", Address: REGBatteryUnderVoltageWarningRecoverVoltage, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "underVoltRecover ", Metric: "solar_battery_config_under_voltage_warning_reconnect_volts", Legacy: "solar_battery_config_under_voltage_warning_reconnect_voltage", Help: "Config Under Voltage Warning Reconnect Voltage"},
+	{Name: "BatteryConfigUnderVoltageWarningVoltage", Address: REGBatteryUnderVoltageWarningVoltage, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "underVoltWarning ", Metric: "solar_battery_config_under_voltage_warning_volts", Legacy: "solar_battery_config_under_voltage_warning_voltage", Help: "Config Under Voltage Warning Voltage"},
+	{Name: "BatteryConfigLowVoltageDisconnectVoltage", Address: REGBatteryLowVoltageDisconnectVoltage, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "lowVoltDisconnect ", Metric: "solar_battery_config_low_voltage_disconnect_volts", Legacy: "solar_battery_config_low_voltage_disconnect_voltage", Help: "Config Low Voltage Disconnect Voltage"},
+	{Name: "BatteryConfigDischargingLimitVoltage", Address: REGBatteryDischargingLimitVoltage, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Battery config", Label: "dischargingLimit ", Metric: "solar_battery_config_discharging_limit_volts", Legacy: "solar_battery_config_discharging_limit_voltage", Help: "Config Discharging Limit Voltage"},
+
+	{Name: "BatteryConfigRatedVoltage", Address: REGBatteryRatedVoltage, Table: HoldingRegister, Group: "Battery config", Label: "ratedVoltage ", Metric: "solar_battery_config_rated_volts", Help: "Config Battery Rated Voltage, 0 for Auto"},
+	{Name: "BatteryConfigManagementMode", Address: REGBatteryChargingMode, Table: HoldingRegister, Group: "Battery config", Label: "management ", Metric: "solar_battery_config_management_mode", StateSet: "solar_battery_management_mode_state", Help: "Config Battery Management Mode"},
+	{Name: "BatteryConfigDischargePercent", Address: REGBatteryDischarge, Table: HoldingRegister, Scale: 100, Unit: "%", Group: "Battery config", Label: "dischargeDepth ", Metric: "solar_battery_config_discharge_ratio", Help: "Config Depth Of Discharge"},
+	{Name: "BatteryConfigChargePercent", Address: REGBatteryChargeDepth, Table: HoldingRegister, Scale: 100, Unit: "%", Group: "Battery config", Label: "chargeDepth ", Metric: "solar_battery_config_charge_ratio", Help: "Config Depth Of Charge"},
+
+	{Name: "BatteryConfigBatteryTempUpperLimit", Address: REGBatteryTempWarningUpperLimit, Table: HoldingRegister, Signed: true, Scale: 100, Unit: "C", Group: "Temp config", Label: "batteryUpper ", Metric: "solar_battery_config_battery_temp_upper_limit_celsius", Help: "Config Battery Temperature Warning Upper Limit"},
+	{Name: "BatteryConfigBatteryTempLowerLimit", Address: REGBatteryTempWarningLowerLimit, Table: HoldingRegister, Signed: true, Scale: 100, Unit: "C", Group: "Temp config", Label: "batteryLower ", Metric: "solar_battery_config_battery_temp_lower_limit_celsius", Help: "Config Battery Temperature Warning Lower Limit"},
+	{Name: "BatteryConfigInnerTempUpperLimit", Address: REGControllerInnerTempUpperLimit, Table: HoldingRegister, Signed: true, Scale: 100, Unit: "C", Group: "Temp config", Label: "insideUpper ", Metric: "solar_battery_config_inner_temp_upper_limit_celsius", Help: "Config Controller Inner Temperature Upper Limit"},
+	{Name: "BatteryConfigInnerTempUpperLimitRecover", Address: REGControllerInnerTempUpperLimitRecover, Table: HoldingRegister, Signed: true, Scale: 100, Unit: "C", Group: "Temp config", Label: "insideRecover ", Metric: "solar_battery_config_inner_temp_upper_limit_recover_celsius", Help: "Config Controller Inner Temperature Upper Limit Recover"},
+	{Name: "BatteryConfigPowerComponentTempUpperLimit", Address: REGPowerComponentTempUpperLimit, Table: HoldingRegister, Signed: true, Scale: 100, Unit: "C", Group: "Temp config", Label: "heatsinkUpper ", Metric: "solar_battery_config_power_component_temp_upper_limit_celsius", Help: "Config Power Component Temperature Upper Limit"},
+	{Name: "BatteryConfigPowerComponentTempUpperLimitRecover", Address: REGPowerComponentTempUpperLimitRecover, Table: HoldingRegister, Signed: true, Scale: 100, Unit: "C", Group: "Temp config", Label: "heatsinkRecover ", Metric: "solar_battery_config_power_component_temp_upper_limit_recover_celsius", Help: "Config Power Component Temperature Upper Limit Recover"},
+	{Name: "BatteryConfigLineImpedance", Address: REGLineImpedance, Table: HoldingRegister, Scale: 100, Unit: "mOhm", Group: "Temp config", Label: "lineImpedance ", Metric: "solar_battery_config_line_impedance_ohms", Help: "Config Line Impedance Ohms"},
+
+	{Name: "ChargeEqualizationDuration", Address: REGBatteryEqualizeDuration, Table: HoldingRegister, Unit: "min", Group: "Charge config", Label: "equalization ", Metric: "solar_config_equalization_duration_seconds", Legacy: "solar_config_equalization_duration", Help: "Config Equalization Duration"},
+	{Name: "ChargeBoostDuration", Address: REGBatteryBoostDuration, Table: HoldingRegister, Unit: "min", Group: "Charge config", Label: "boost ", Metric: "solar_config_boost_duration_seconds", Legacy: "solar_config_boost_duration", Help: "Config Boost Duration"},
+	{Name: "ChargeEqualizePeriodDays", Address: REGBatteryEqualizePeriodDays, Table: HoldingRegister, Unit: "days", Group: "Charge config", Label: "equalizationPeriod ", Metric: "solar_config_equalization_period_seconds", Legacy: "solar_config_equalization_period", Help: "Config Equalization Period"},
+
+	{Name: "LoadControlMode", Address: REGLoadControlMode, Table: HoldingRegister, Group: "Load config", Label: "mode ", Metric: "solar_load_config_mode", Help: "Config Load Control Mode"},
+	{Name: "LoadTimingSelection", Address: REGLoadTimingSelection, Table: HoldingRegister, Group: "Load config", Metric: "solar_load_config_timing_selection", Help: "Config Load Timing Selection"},
+	{Name: "LoadDefaultOn", Address: REGDefaultLoadManual, Table: HoldingRegister, Group: "Load config", Label: "defaultOn", Metric: "solar_load_config_default_on", Help: "Config Default Load On In Manual Mode"},
+	{Name: "LoadNightThresholdVoltage", Address: REGNightTimeThresholdVolt, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Load config", Label: "night ", Metric: "solar_load_config_night_threshold_volts", Help: "Config Night Time Threshold Voltage"},
+	{Name: "LoadLightOnDelay", Address: REGLightOnDelay, Table: HoldingRegister, Unit: "min", Group: "Load config", Label: "onDelay ", Metric: "solar_load_config_light_on_delay_seconds", Help: "Config Light On Delay Seconds"},
+	{Name: "LoadDayThresholdVoltage", Address: REGDayTimeThresholdVolt, Table: HoldingRegister, Scale: 100, Unit: "V", Group: "Load config", Label: "day ", Metric: "solar_load_config_day_threshold_volts", Help: "Config Day Time Threshold Voltage"},
+	{Name: "LoadLightOffDelay", Address: REGLightOffDelay, Table: HoldingRegister, Unit: "min", Group: "Load config", Label: "offDelay ", Metric: "solar_load_config_light_off_delay_seconds", Help: "Config Light Off Delay Seconds"},
+	{Name: "LoadNightLengthHour", Address: REGLengthOfNight, Table: HoldingRegister, Shift: 8, Mask: 0xff, Unit: "h", Group: "Load config", Label: "nightLength "},
+	{Name: "LoadNightLengthMin", Address: REGLengthOfNight, Table: HoldingRegister, Shift: 0, Mask: 0xff, Unit: "m", Group: "Load config"},
+	{Name: "LoadWorkingTime1Hour", Address: REGLoadWorkingTime1, Table: HoldingRegister, Shift: 8, Mask: 0xff, Unit: "h", Group: "Load timer", Label: "working1 "},
+	{Name: "LoadWorkingTime1Min", Address: REGLoadWorkingTime1, Table: HoldingRegister, Shift: 0, Mask: 0xff, Unit: "m", Group: "Load timer"},
+	{Name: "LoadWorkingTime2Hour", Address: REGLoadWorkingTime2, Table: HoldingRegister, Shift: 8, Mask: 0xff, Unit: "h", Group: "Load timer", Label: "working2 "},
+	{Name: "LoadWorkingTime2Min", Address: REGLoadWorkingTime2, Table: HoldingRegister, Shift: 0, Mask: 0xff, Unit: "m", Group: "Load timer"},
+	{Name: "LoadTurnOn1Hour", Address: REGLoadTurnOn1Hour, Table: HoldingRegister, Unit: "h", Group: "Load timer", Label: "on1 "},
+	{Name: "LoadTurnOn1Min", Address: REGLoadTurnOn1Min, Table: HoldingRegister, Unit: "m", Group: "Load timer"},
+	{Name: "LoadTurnOn1Sec", Address: REGLoadTurnOn1Sec, Table: HoldingRegister, Unit: "s", Group: "Load timer"},
+	{Name: "LoadTurnOff1Hour", Address: REGLoadTurnOff1Hour, Table: HoldingRegister, Unit: "h", Group: "Load timer", Label: "off1 "},
+	{Name: "LoadTurnOff1Min", Address: REGLoadTurnOff1Min, Table: HoldingRegister, Unit: "m", Group: "Load timer"},
+	{Name: "LoadTurnOff1Sec", Address: REGLoadTurnOff1Sec, Table: HoldingRegister, Unit: "s", Group: "Load timer"},
+	{Name: "LoadTurnOn2Hour", Address: REGLoadTurnOn2Hour, Table: HoldingRegister, Unit: "h", Group: "Load timer", Label: "on2 "},
+	{Name: "LoadTurnOn2Min", Address: REGLoadTurnOn2Min, Table: HoldingRegister, Unit: "m", Group: "Load timer"},
+	{Name: "LoadTurnOn2Sec", Address: REGLoadTurnOn2Sec, Table: HoldingRegister, Unit: "s", Group: "Load timer"},
+	{Name: "LoadTurnOff2Hour", Address: REGLoadTurnOff2Hour, Table: HoldingRegister, Unit: "h", Group: "Load timer", Label: "off2 "},
+	{Name: "LoadTurnOff2Min", Address: REGLoadTurnOff2Min, Table: HoldingRegister, Unit: "m", Group: "Load timer"},
+	{Name: "LoadTurnOff2Sec", Address: REGLoadTurnOff2Sec, Table: HoldingRegister, Unit: "s", Group: "Load timer"},
+
+	{Name: "CoilChargingDevice", Address: COILChargingDeviceOnOff, Table: Coil, Group: "Coils", Label: "charging", Metric: "solar_coil_charging_device", Help: "Coil Charging Device On"},
+	{Name: "CoilOutputControlManual", Address: COILOutputControlMode, Table: Coil, Group: "Coils", Label: "manualOutput", Metric: "solar_coil_output_control_manual", Help: "Coil Output Control Mode Manual"},
+	{Name: "CoilManualLoad", Address: COILManualLoadControl, Table: Coil, Group: "Coils", Label: "manualLoad", Metric: "solar_coil_manual_load", Help: "Coil Manual Load On"},
+	{Name: "CoilDefaultLoad", Address: COILDefaultLoadControl, Table: Coil, Group: "Coils", Label: "defaultLoad", Metric: "solar_coil_default_load", Help: "Coil Default Load On"},
+	{Name: "CoilLoadTestMode", Address: COILLoadTestMode, Table: Coil, Group: "Coils", Label: "loadTest", Metric: "solar_coil_load_test_mode", Help: "Coil Load Test Mode"},
+	{Name: "CoilForceLoad", Address: COILForceLoad, Table: Coil, Group: "Coils", Label: "forceLoad", Metric: "solar_coil_force_load", Help: "Coil Force Load On"},
+
+	{Name: "RTCsec", Address: REGRTCSecMin, Table: HoldingRegister, Shift: 0, Mask: 0xff},
+	{Name: "RTCmin", Address: REGRTCSecMin, Table: HoldingRegister, Shift: 8, Mask: 0xff},
+	{Name: "RTChour", Address: REGRTCHourDay, Table: HoldingRegister, Shift: 0, Mask: 0xff},
+	{Name: "RTCday", Address: REGRTCHourDay, Table: HoldingRegister, Shift: 8, Mask: 0xff},
+	{Name: "RTCmonth", Address: REGRTCMonthYear, Table: HoldingRegister, Shift: 0, Mask: 0xff},
+	{Name: "RTCyear", Address: REGRTCMonthYear, Table: HoldingRegister, Shift: 8, Mask: 0xff},
+}
+
+// words is the width of the register in 16 bit words
+func (r Register) words() uint16 {
+	if r.Words == 2 {
+		return 2
+	}
+	return 1
+}
+
+// decode converts the raw register contents into the value stored in the snapshot
+func (r Register) decode(raw uint32) float64 {
+	if r.Mask != 0 {
+		return float64((raw >> r.Shift) & uint32(r.Mask))
+	}
+	v := float64(raw)
+	if r.Signed {
+		if r.words() == 2 {
+			v = float64(int32(raw))
+		} else {
+			v = float64(int16(raw))
+		}
+	}
+	if r.Scale != 0 {
+		v /= r.Scale
+	}
+	return v
+}
+
+// encode converts a snapshot value back into raw register contents, the inverse of decode
+func (r Register) encode(v float64) uint32 {
+	if r.Mask != 0 {
+		return (uint32(v) & uint32(r.Mask)) << r.Shift
+	}
+	if r.Scale != 0 {
+		v *= r.Scale
+	}
+	v = math.Round(v)
+	if r.Signed {
+		if r.words() == 2 {
+			return uint32(int32(v))
+		}
+		return uint32(uint16(int16(v)))
+	}
+	return uint32(v)
+}
+
+// Value returns the register's value in the snapshot as a number, flags are 0 or 1
+func (r Register) Value(s Snapshot) float64 {
+	f := reflect.ValueOf(s).FieldByName(r.Name)
+	switch f.Kind() {
+	case reflect.Bool:
+		if f.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(f.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(f.Uint())
+	}
+	return f.Float()
+}
+
+// amount is an enum whose states stand for a quantity, like the rated voltage
+type amount interface {
+	Amount() float64
+}
+
+// MetricValue returns the value as exported to prometheus in the base unit
+// its name ends in: percentages become ratios, minutes and days seconds,
+// milliohms ohms, and enums standing for a quantity that quantity
+func (r Register) MetricValue(s Snapshot) float64 {
+	if a, ok := reflect.ValueOf(s).FieldByName(r.Name).Interface().(amount); ok {
+		return a.Amount()
+	}
+	switch r.Unit {
+	case "%":
+		return r.Value(s) / 100
+	case "min":
+		return r.Value(s) * 60
+	case "days":
+		return r.Value(s) * 24 * 60 * 60
+	case "mOhm":
+		return r.Value(s) / 1000
+	}
+	return r.Value(s)
+}
+
+// LegacyMetricValue returns the value as exported under the Legacy name,
+// where only percentages were converted, to ratios
+func (r Register) LegacyMetricValue(s Snapshot) float64 {
+	if r.Unit == "%" {
+		return r.Value(s) / 100
+	}
+	return r.Value(s)
+}
+
+// States lists the names of every state an enum field can hold, by the
+// String() of each value its bit field can carry. Values without a name are
+// left out.
+func (r Register) States() []string {
+	t, ok := reflect.TypeOf(Snapshot{}).FieldByName(r.Name)
+	if !ok {
+		return nil
+	}
+	max := uint64(r.Mask)
+	if max == 0 {
+		max = 0xffff
+	}
+	var states []string
+	v := reflect.New(t.Type).Elem()
+	for i := uint64(0); i <= max; i++ {
+		v.SetInt(int64(i))
+		stringer, ok := v.Interface().(fmt.Stringer)
+		if !ok {
+			return nil
+		}
+		if name := stringer.String(); !strings.HasPrefix(name, "Unknown(") {
+			states = append(states, name)
+		}
+	}
+	return states
+}
+
+// State returns the name of the state an enum field holds
+func (r Register) State(s Snapshot) string {
+	return fmt.Sprint(reflect.ValueOf(s).FieldByName(r.Name).Interface())
+}
+
+// set stores a decoded value into the snapshot field
+func (r Register) set(s *Snapshot, v float64) {
+	f := reflect.ValueOf(s).Elem().FieldByName(r.Name)
+	switch f.Kind() {
+	case reflect.Bool:
+		f.SetBool(v != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.SetInt(int64(v))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f.SetUint(uint64(v))
+	default:
+		f.SetFloat(v)
+	}
+}
+
+// format shows the value for String(), or "" for a flag that isn't set
+func (r Register) format(s Snapshot) string {
+	f := reflect.ValueOf(s).FieldByName(r.Name)
+	if f.Kind() == reflect.Bool {
+		if f.Bool() {
+			return r.Label
+		}
+		return ""
+	}
+	if stringer, ok := f.Interface().(fmt.Stringer); ok {
+		return r.Label + stringer.String()
+	}
+	if r.Scale > 1 {
+		return fmt.Sprintf("%s%.2f%s", r.Label, r.Value(s), r.Unit)
+	}
+	return fmt.Sprintf("%s%.0f%s", r.Label, r.Value(s), r.Unit)
+}
+
+// block is one contiguous run of registers fetched with a single request
+type block struct {
+	table    Table
+	address  uint16
+	quantity uint16
+	regs     []Register
+	parts    []block // The contiguous blocks a coalesced read was merged from
+}
+
+// planBlocks groups the registers into as few contiguous requests as possible.
+// The blocks have no gaps, so they can be written as well as read.
+func planBlocks(regs []Register) []block {
+	sorted := append([]Register{}, regs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Table != sorted[j].Table {
+			return sorted[i].Table < sorted[j].Table
+		}
+		return sorted[i].Address < sorted[j].Address
+	})
+
+	var blocks []block
+	for _, r := range sorted {
+		end := r.Address + r.words()
+		if n := len(blocks); n > 0 {
+			b := &blocks[n-1]
+			if b.table == r.Table && r.Address <= b.address+b.quantity {
+				if end > b.address+b.quantity {
+					b.quantity = end - b.address
+				}
+				b.regs = append(b.regs, r)
+				continue
+			}
+		}
+		blocks = append(blocks, block{table: r.Table, address: r.Address, quantity: r.words(), regs: []Register{r}})
+	}
+	return blocks
+}
+
+// decode every register in the block from the data read for it
+func (b block) decode(s *Snapshot, data []byte) {
+	for _, r := range b.regs {
+		offset := r.Address - b.address
+		var raw uint32
+		switch b.table {
+		case Coil, DiscreteInput:
+			raw = uint32(data[offset/8]>>(offset%8)) & 1
+		default:
+			raw = uint32(binary.BigEndian.Uint16(data[2*offset:]))
+			if r.words() == 2 {
+				raw |= uint32(binary.BigEndian.Uint16(data[2*offset+2:])) << 16
+			}
+		}
+		r.set(s, r.decode(raw))
+	}
+}
+
+// encode builds the data to write the block from the snapshot values. Bit
+// fields sharing a register are combined. Only register tables can be encoded.
+func (b block) encode(s Snapshot) []byte {
+	data := make([]byte, 2*b.quantity)
+	for _, r := range b.regs {
+		offset := r.Address - b.address
+		raw := r.encode(r.Value(s))
+		binary.BigEndian.PutUint16(data[2*offset:], binary.BigEndian.Uint16(data[2*offset:])|uint16(raw))
+		if r.words() == 2 {
+			binary.BigEndian.PutUint16(data[2*offset+2:], uint16(raw>>16))
+		}
+	}
+	return data
+}
+
+// registersIn returns the entries of the register map in one table between
+// two addresses inclusive
+func registersIn(table Table, from, to uint16) []Register {
+	var regs []Register
+	for _, r := range Registers {
+		if r.Table == table && r.Address >= from && r.Address <= to {
+			regs = append(regs, r)
+		}
+	}
+	return regs
+}
+
+// refreshBlocks is the read plan used by Refresh
+var refreshBlocks = coalesce(planBlocks(Registers))
+
+func init() {
+	// Catch typos in the register map as soon as the package loads
+	t := reflect.TypeOf(Snapshot{})
+	for _, r := range Registers {
+		if _, ok := t.FieldByName(r.Name); !ok {
+			panic(fmt.Sprintf("epever: register 0x%04x maps to unknown Snapshot field %q", r.Address, r.Name))
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package epever
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRegisterDecode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		reg  Register
+		raw  uint32
+		want float64
+	}{
+		{"unsigned 16", Register{Scale: 100}, 0xfc18, 645.36},
+		{"signed 16 positive", Register{Signed: true, Scale: 100}, 1723, 17.23},
+		{"signed 16 negative", Register{Signed: true, Scale: 100}, 0xfc18, -10.00},
+		{"signed 16 minimum", Register{Signed: true}, 0x8000, -32768},
+		{"signed 16 minus one", Register{Signed: true, Scale: 100}, 0xffff, -0.01},
+		{"unsigned 32", Register{Words: 2, Scale: 100}, 0x0001_86a0, 1000},
+		{"signed 32 negative", Register{Words: 2, Signed: true, Scale: 100}, 0xffff_ffe4, -0.28},
+		{"signed 32 large negative", Register{Words: 2, Signed: true, Scale: 100}, 0xfffe_7960, -1000},
+		{"bit field ignores sign", Register{Signed: true, Shift: 14, Mask: 0b11}, 0xc000, 3},
+	} {
+		if got := tc.reg.decode(tc.raw); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: decode(0x%x) = %v, want %v", tc.name, tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestSignedRegisters(t *testing.T) {
+	// Winter at the shed: every temperature below zero, battery discharging
+	words := map[uint16]uint16{
+		REGBatteryCurrent:     0xff38, // -2.00A
+		REGTempBattery:        0xfc18, // -10.00C
+		REGTempInside:         0xfe0c, // -5.00C
+		REGTempHeatsink:       0xffce, // -0.50C
+		REGTempRemoteBattery:  0xfb50, // -12.00C
+		REGBatteryNetCurrentL: 0xfc18,
+		REGBatteryNetCurrentH: 0xffff, // -10.00A
+
+		// An unsigned neighbour in the same block
+		REGBatteryRealRatedVoltage: 2400, // 24.00V
+	}
+	var s Snapshot
+	for _, b := range planBlocks(Registers) {
+		if b.table != InputRegister {
+			continue
+		}
+		data := make([]byte, 2*b.quantity)
+		for i := uint16(0); i < b.quantity; i++ {
+			v := words[b.address+i]
+			data[2*i] = byte(v >> 8)
+			data[2*i+1] = byte(v)
+		}
+		b.decode(&s, data)
+	}
+
+	for _, tc := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"BatteryCurrent", s.BatteryCurrent, -2},
+		{"TempBattery", s.TempBattery, -10},
+		{"TempInside", s.TempInside, -5},
+		{"TempHeatsink", s.TempHeatsink, -0.5},
+		{"TempRemoteBattery", s.TempRemoteBattery, -12},
+		{"BatteryNetCurrent", s.BatteryNetCurrent, -10},
+		{"BatteryRealRatedVoltage", s.BatteryRealRatedVoltage, 24},
+	} {
+		if math.Abs(tc.got-tc.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestStateSets(t *testing.T) {
+	for _, r := range Registers {
+		if r.StateSet == "" {
+			continue
+		}
+		if states := r.States(); len(states) < 2 {
+			t.Errorf("%s has states %v", r.Name, states)
+		}
+	}
+
+	r, _ := LookupRegister("StatusBatteryVolt")
+	if got := strings.Join(r.States(), ","); got != "NormalVolt,OverVolt,UnderVolt,LowVoltDisconnect,FaultVolt" {
+		t.Errorf("battery voltage states are %s", got)
+	}
+	if got := r.State(Snapshot{StatusBatteryVolt: UnderVolt}); got != "UnderVolt" {
+		t.Errorf("state is %s", got)
+	}
+}
+
+// decodeWord decodes a single register value the way a read of it would
+func decodeWord(table Table, address, value uint16) Snapshot {
+	var regs []Register
+	for _, r := range Registers {
+		if r.Table == table && r.Address == address {
+			regs = append(regs, r)
+		}
+	}
+	var s Snapshot
+	for _, b := range planBlocks(regs) {
+		b.decode(&s, []byte{byte(value >> 8), byte(value)})
+	}
+	return s
+}
+
+func TestDischargingStatus(t *testing.T) {
+	bits := []struct {
+		name  string
+		shift uint
+		got   func(Snapshot) bool
+	}{
+		{"Running", 0, func(s Snapshot) bool { return s.StatusDischargingRunning }},
+		{"Fault", 1, func(s Snapshot) bool { return s.StatusDischargingFault }},
+		{"OutputOverVoltage", 4, func(s Snapshot) bool { return s.StatusDischargingOutputOverVoltage }},
+		{"BoostOverVoltage", 5, func(s Snapshot) bool { return s.StatusDischargingBoostOverVoltage }},
+		{"HighVoltageSideShort", 6, func(s Snapshot) bool { return s.StatusDischargingHighVoltageSideShort }},
+		{"InputOverVoltage", 7, func(s Snapshot) bool { return s.StatusDischargingInputOverVoltage }},
+		{"OutputVoltAbnormal", 8, func(s Snapshot) bool { return s.StatusDischargingOutputVoltAbnormal }},
+		{"UnableToStop", 9, func(s Snapshot) bool { return s.StatusDischargingUnableToStop }},
+		{"UnableToDischarge", 10, func(s Snapshot) bool { return s.StatusDischargingUnableToDischarge }},
+		{"ShortCircuit", 11, func(s Snapshot) bool { return s.StatusDischargingShortCircuit }},
+	}
+	// Each bit sets its own flag and no other
+	for _, bit := range bits {
+		s := decodeWord(InputRegister, REGDischargingStatus, 1<<bit.shift)
+		for _, other := range bits {
+			if got := other.got(s); got != (other.name == bit.name) {
+				t.Errorf("bit %d: %s = %v", bit.shift, other.name, got)
+			}
+		}
+		if s.StatusDischargingOutputPower != LightLoad || s.StatusDischargingInputVoltStatus != NormalDischargeInputVolt {
+			t.Errorf("bit %d: output power %v, input voltage %v", bit.shift, s.StatusDischargingOutputPower, s.StatusDischargingInputVoltStatus)
+		}
+	}
+
+	// Running at rated load with the input voltage high and a short circuit
+	s := decodeWord(InputRegister, REGDischargingStatus, 0b10_10_1000_0000_0001)
+	if s.StatusDischarging != 0xa801 {
+		t.Errorf("status word is 0x%x", s.StatusDischarging)
+	}
+	if !s.StatusDischargingRunning || !s.StatusDischargingShortCircuit || s.StatusDischargingFault {
+		t.Errorf("running %v, short circuit %v, fault %v", s.StatusDischargingRunning, s.StatusDischargingShortCircuit, s.StatusDischargingFault)
+	}
+	if s.StatusDischargingOutputPower != RatedLoad {
+		t.Errorf("output power is %v", s.StatusDischargingOutputPower)
+	}
+	if s.StatusDischargingInputVoltStatus != HighDischargeInputVolt {
+		t.Errorf("input voltage is %v", s.StatusDischargingInputVoltStatus)
+	}
+}
+
+func TestHoldingEnums(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		reg    uint16
+		raw    uint16
+		state  string
+		metric float64
+	}{
+		{"BatteryConfigRatedVoltage", REGBatteryRatedVoltage, 0, "Auto", 0},
+		{"BatteryConfigRatedVoltage", REGBatteryRatedVoltage, 2, "24V", 24},
+		{"BatteryConfigRatedVoltage", REGBatteryRatedVoltage, 9, "240V", 240},
+		{"BatteryConfigManagementMode", REGBatteryChargingMode, 1, "SOC", 1},
+		{"LoadControlMode", REGLoadControlMode, 3, "TimeControl", 3},
+		{"LoadTimingSelection", REGLoadTimingSelection, 1, "TwoTimers", 1},
+	} {
+		r, ok := LookupRegister(tc.name)
+		if !ok {
+			t.Fatalf("no register %s", tc.name)
+		}
+		s := decodeWord(HoldingRegister, tc.reg, tc.raw)
+		if got := r.State(s); got != tc.state {
+			t.Errorf("%s %d decodes as %s, want %s", tc.name, tc.raw, got, tc.state)
+		}
+		if got := r.MetricValue(s); got != tc.metric {
+			t.Errorf("%s %d exported as %v, want %v", tc.name, tc.raw, got, tc.metric)
+		}
+	}
+
+	if s := decodeWord(HoldingRegister, REGBatteryType, 2); s.BatteryConfigBatteryType != 2 {
+		t.Errorf("battery type decodes as %d", s.BatteryConfigBatteryType)
+	}
+
+	r, _ := LookupRegister("BatteryConfigManagementMode")
+	if got := strings.Join(r.States(), ","); got != "VoltageCompensation,SOC" {
+		t.Errorf("management mode states are %s", got)
+	}
+}
@@ -0,0 +1,62 @@
+package epever
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy says how often, and how patiently, a failed read is retried
+type RetryPolicy struct {
+	MaxAttempts    int           // Total attempts including the first, at least 1
+	InitialBackoff time.Duration // Wait before the second attempt
+	MaxBackoff     time.Duration // Upper bound on any single wait
+	Multiplier     float64       // Growth of the wait per attempt
+	Jitter         float64       // Random fraction (0-1) added or removed from each wait
+}
+
+// DefaultRetryPolicy is used by NewEpever
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// Backoff returns how long to wait after the given failed attempt (1 based)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+		if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+			d = float64(p.MaxBackoff)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	return time.Duration(d)
+}
+
+// retryable says if another attempt could succeed after this class of failure.
+// An exception is the device answering, so asking again gives the same answer.
+func retryable(class ErrorClass) bool {
+	return class != ClassException && class != ClassCanceled
+}
+
+// sleepContext waits for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
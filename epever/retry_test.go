@@ -0,0 +1,150 @@
+package epever
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	for attempt, want := range []time.Duration{0, 100, 200, 400, 800, 1000, 1000} {
+		if attempt == 0 {
+			continue
+		}
+		if got := p.Backoff(attempt); got != want*time.Millisecond {
+			t.Errorf("backoff after attempt %d is %v, want %v", attempt, got, want*time.Millisecond)
+		}
+	}
+
+	// Jitter spreads the wait either side, but never past the maximum
+	p.Jitter = 0.2
+	low, high := time.Hour, time.Duration(0)
+	for i := 0; i < 1000; i++ {
+		d := p.Backoff(1)
+		if d < low {
+			low = d
+		}
+		if d > high {
+			high = d
+		}
+		if d := p.Backoff(10); d > p.MaxBackoff || d < 800*time.Millisecond {
+			t.Fatalf("backoff after attempt 10 is %v, want 800ms-1s", d)
+		}
+	}
+	if low < 80*time.Millisecond || high > 120*time.Millisecond || high-low < 20*time.Millisecond {
+		t.Errorf("jittered backoff ranged %v-%v, want spread within 80-120ms", low, high)
+	}
+}
+
+// netTimeout is a net.Error that timed out
+type netTimeout struct{}
+
+func (netTimeout) Error() string   { return "i/o timeout" }
+func (netTimeout) Timeout() bool   { return true }
+func (netTimeout) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want ErrorClass
+	}{
+		{context.Canceled, ClassCanceled},
+		{context.DeadlineExceeded, ClassTimeout},
+		{netTimeout{}, ClassTimeout},
+		{fmt.Errorf("read: %w", netTimeout{}), ClassTimeout},
+		{&modbus.ModbusError{FunctionCode: 4, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}, ClassException},
+		{fmt.Errorf("modbus: response crc '1234' does not match expected '5678'"), ClassCRC},
+		{fmt.Errorf("modbus: response length '3' does not meet minimum '5'"), ClassCRC},
+		{io.EOF, ClassDisconnected},
+		{errors.New("connection refused"), ClassDisconnected},
+	} {
+		if got := classify(tc.err); got != tc.want {
+			t.Errorf("%v classified as %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+// retryEpever is a controller at address that times out quickly and retries
+// without waiting
+func retryEpever(t *testing.T, address string, attempts int) *Epever {
+	ep, err := NewEpever("tcp://" + address + "?timeout=100ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ep.Close() })
+	ep.Retry = RetryPolicy{MaxAttempts: attempts, InitialBackoff: time.Millisecond, Multiplier: 1}
+	return ep
+}
+
+func TestRetryTimeout(t *testing.T) {
+	slave := newFakeSlave(1)
+	slave.input[REGBatteryPercent] = 56
+	slave.drop = 2
+	ep := retryEpever(t, slave.serveTCP(t), 4)
+
+	data, err := ep.readWithRetry(context.Background(), REGBatteryPercent, 1)
+	if err != nil || len(data) != 2 || data[1] != 56 {
+		t.Fatalf("read % x, %v after two timeouts", data, err)
+	}
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	if slave.drop != 0 || slave.requests != 1 {
+		t.Errorf("%d requests dropped and %d answered, want 2 and 1", 2-slave.drop, slave.requests)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	slave := newFakeSlave(1)
+	slave.input[REGBatteryPercent] = 56
+	slave.drop = 10
+	ep := retryEpever(t, slave.serveTCP(t), 3)
+
+	_, err := ep.readWithRetry(context.Background(), REGBatteryPercent, 1)
+	var readErr *ReadError
+	if !errors.As(err, &readErr) || readErr.Attempts != 3 || readErr.Class != ClassTimeout {
+		t.Fatalf("got %#v, want a ReadError after 3 timed out attempts", err)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("%v doesn't match ErrTimeout", err)
+	}
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	if slave.drop != 7 {
+		t.Errorf("%d requests sent, want 3", 10-slave.drop)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// A slave that never answers, canceling once it has been asked
+	address := listen(t, func(conn net.Conn) error {
+		_, err := conn.Read(make([]byte, 260))
+		cancel()
+		return err
+	})
+	ep := retryEpever(t, address, 4)
+	ep.Retry.InitialBackoff = time.Hour
+
+	done := make(chan error)
+	go func() {
+		_, err := ep.readWithRetry(ctx, REGBatteryPercent, 1)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want canceled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("canceling didn't stop the backoff")
+	}
+}
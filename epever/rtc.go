@@ -0,0 +1,92 @@
+package epever
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// rtcBlock is the write plan for the controller clock, 9013-9015
+var rtcBlock = planBlocks(registersIn(HoldingRegister, REGRTCSecMin, REGRTCMonthYear))[0]
+
+// rtcTolerance is how far the clock may read back from the time written, to
+// allow for the seconds ticking over between the write and the read
+const rtcTolerance = 2 * time.Second
+
+// RTC returns the controller clock read into the snapshot. The controller
+// keeps wall clock time with no zone, so it is interpreted in loc.
+func (s Snapshot) RTC(loc *time.Location) time.Time {
+	return time.Date(2000+int(s.RTCyear), time.Month(s.RTCmonth), int(s.RTCday),
+		int(s.RTChour), int(s.RTCmin), int(s.RTCsec), 0, loc)
+}
+
+// setRTC copies the wall clock fields of t into the snapshot
+func (s *Snapshot) setRTC(t time.Time) {
+	s.RTCyear = uint16(t.Year() - 2000)
+	s.RTCmonth = uint16(t.Month())
+	s.RTCday = uint16(t.Day())
+	s.RTChour = uint16(t.Hour())
+	s.RTCmin = uint16(t.Minute())
+	s.RTCsec = uint16(t.Second())
+}
+
+// ReadRTC reads the controller clock, interpreted in loc
+func (e *Epever) ReadRTC(ctx context.Context, loc *time.Location) (time.Time, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	return e.readRTC(ctx, loc)
+}
+
+// readRTC reads the clock into the snapshot. Caller must hold the bus mutex.
+func (e *Epever) readRTC(ctx context.Context, loc *time.Location) (time.Time, error) {
+	b := rtcBlock
+	data, err := e.readTable(ctx, b.table, b.address, b.quantity)
+	if err != nil {
+		return time.Time{}, err
+	}
+	e.decodeSnapshot(b, data)
+	return e.snapshot.RTC(loc), nil
+}
+
+// decodeSnapshot decodes a read into the snapshot, noting when the clock was
+// read if the block holds it. Caller must hold the bus mutex.
+func (e *Epever) decodeSnapshot(b block, data []byte) {
+	b.decode(&e.snapshot, data)
+	if b.table == HoldingRegister && b.address <= REGRTCMonthYear && b.address+b.quantity > REGRTCSecMin {
+		e.snapshot.RTCTaken = time.Now()
+	}
+}
+
+// SetRTC sets the controller clock to the wall clock time now returns, so
+// pass a func returning time.Now().In(loc) for the zone the controller should
+// keep. now is called once the bus is free, so time spent waiting for other
+// requests doesn't make the clock late. The clock is read back and must be
+// within a couple of seconds of the time written, which is returned.
+func (e *Epever) SetRTC(ctx context.Context, now func() time.Time) (time.Time, error) {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+
+	t := now()
+	if t.Year() < 2000 || t.Year() > 2255 {
+		return t, fmt.Errorf("%w: controller clock can't hold the year %d", ErrInvalidConfig, t.Year())
+	}
+
+	var s Snapshot
+	s.setRTC(t)
+	w := blockWrite(rtcBlock, s)
+	// The old time is stale by the time a rollback could write it back
+	w.keep = true
+	want := t.Truncate(time.Second)
+	started := time.Now()
+	w.verify = func(words []uint16) error {
+		var read Snapshot
+		rtcBlock.decodeWords(&read, words)
+		got := read.RTC(t.Location())
+		if got.Before(want.Add(-rtcTolerance)) || got.After(want.Add(time.Since(started)+rtcTolerance)) {
+			return fmt.Errorf("clock reads back %s after writing %s", got.Format(time.RFC3339), want.Format(time.RFC3339))
+		}
+		return nil
+	}
+	return t, e.commit(ctx, []regWrite{w})
+}
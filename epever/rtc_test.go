@@ -0,0 +1,63 @@
+package epever
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSetRTC(t *testing.T) {
+	slave := newFakeSlave(1)
+	for a := uint16(REGRTCSecMin); a <= REGRTCMonthYear; a++ {
+		slave.holding[a] = 0
+	}
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	ctx := context.Background()
+
+	loc := time.FixedZone("NZDT", 13*60*60)
+	want := time.Date(2022, 3, 19, 17, 26, 21, 0, loc)
+	written, err := ep.SetRTC(ctx, func() time.Time { return want })
+	if err != nil || !written.Equal(want) {
+		t.Fatalf("wrote %v, %v", written, err)
+	}
+	// Seconds and minutes share a register, low byte first
+	if got := slave.holding[REGRTCSecMin]; got != 26<<8|21 {
+		t.Errorf("sec/min register holds 0x%04x", got)
+	}
+	// The clock read back is the snapshot's, timed with it
+	if s := ep.Snapshot(); !s.RTC(loc).Equal(want) || s.RTCTaken.IsZero() {
+		t.Errorf("snapshot clock %v taken %v after setting it", s.RTC(loc), s.RTCTaken)
+	}
+	before := ep.Snapshot().RTCTaken
+	if got, err := ep.ReadRTC(ctx, loc); err != nil || !got.Equal(want) {
+		t.Errorf("clock reads %v, %v, want %v", got, err, want)
+	}
+	if taken := ep.Snapshot().RTCTaken; !taken.After(before) {
+		t.Errorf("clock read taken %v, not after %v", taken, before)
+	}
+
+	// The time is taken once the bus is free, not while waiting for it
+	taken := make(chan struct{}, 1)
+	done := make(chan error)
+	ep.bus.mu.Lock()
+	go func() {
+		_, err := ep.SetRTC(ctx, func() time.Time {
+			taken <- struct{}{}
+			return want
+		})
+		done <- err
+	}()
+	select {
+	case <-taken:
+		t.Error("time taken while the bus was busy")
+	case <-time.After(50 * time.Millisecond):
+	}
+	ep.bus.mu.Unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
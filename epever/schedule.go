@@ -0,0 +1,211 @@
+package epever
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PollGroup is a set of registers worth reading at the same rate
+type PollGroup int
+
+const (
+	RealtimeGroup PollGroup = iota // PV, battery and load readings, temperatures
+	StatusGroup                    // Status words, discrete inputs and coils
+	StatsGroup                     // Daily extremes and energy totals
+	RTCGroup                       // Controller clock
+	ConfigGroup                    // Ratings and settings, which only change when written
+)
+
+// PollGroups lists every group, in the order the scheduler favours them
+var PollGroups = []PollGroup{RealtimeGroup, StatusGroup, StatsGroup, RTCGroup, ConfigGroup}
+
+func (me PollGroup) String() string {
+	return enumName(int(me), "realtime", "status", "stats", "rtc", "config")
+}
+
+// PollGroup says which group a register is read with
+func (r Register) PollGroup() PollGroup {
+	switch {
+	case r.Table == Coil || r.Table == DiscreteInput:
+		return StatusGroup
+	case r.Table == HoldingRegister && r.Address >= REGRTCSecMin && r.Address <= REGRTCMonthYear:
+		return RTCGroup
+	case r.Table == HoldingRegister || r.Address < REGChargeVoltage:
+		return ConfigGroup
+	case r.Address >= REGBatteryStatus && r.Address <= REGDischargingStatus:
+		return StatusGroup
+	case r.Address >= REGBatteryVoltageTodayMax && r.Address <= REGGeneratedH:
+		return StatsGroup
+	}
+	return RealtimeGroup
+}
+
+// groupBlocks is the read plan of each poll group
+var groupBlocks = func() map[PollGroup][]block {
+	regs := map[PollGroup][]Register{}
+	for _, r := range Registers {
+		regs[r.PollGroup()] = append(regs[r.PollGroup()], r)
+	}
+	blocks := map[PollGroup][]block{}
+	for g, rs := range regs {
+		blocks[g] = coalesce(planBlocks(rs))
+	}
+	return blocks
+}()
+
+// PollIntervals says how often each group is read. A group without an
+// interval is static: it is read once, again after the bus reconnects (the
+// controller may have been swapped or reset), and on demand.
+type PollIntervals map[PollGroup]time.Duration
+
+// DefaultPollIntervals reads readings every few seconds and never rereads the
+// settings unprompted
+var DefaultPollIntervals = PollIntervals{
+	RealtimeGroup: 5 * time.Second,
+	StatusGroup:   15 * time.Second,
+	StatsGroup:    time.Minute,
+	RTCGroup:      time.Hour,
+}
+
+// staticRetry is how soon a static group that failed to read is tried again
+const staticRetry = time.Minute
+
+// Scheduler polls the controllers of one bus group by group, each at its own
+// interval. It runs one read at a time, most frequent group first, and a read
+// that falls behind is done once rather than repeated to catch up, so a slow
+// link is never asked for more than it can carry.
+type Scheduler struct {
+	Intervals PollIntervals
+
+	// OnRefresh is called after every group read with the controller's
+	// snapshot, or the error that stopped the read
+	OnRefresh func(e *Epever, g PollGroup, s Snapshot, err error)
+
+	mu   sync.Mutex
+	jobs []*pollJob
+	wake chan struct{}
+}
+
+// pollJob is one group of one controller
+type pollJob struct {
+	ep         *Epever
+	group      PollGroup
+	next       time.Time // Due at or after this
+	idle       bool      // A static group that isn't read again until the bus reconnects or it is demanded
+	reconnects int       // Bus reconnects when the group was last read
+}
+
+// NewScheduler polls the given controllers, which should share one bus
+func NewScheduler(eps []*Epever, intervals PollIntervals) *Scheduler {
+	s := &Scheduler{Intervals: intervals, wake: make(chan struct{}, 1)}
+	for _, g := range PollGroups {
+		for _, e := range eps {
+			s.jobs = append(s.jobs, &pollJob{ep: e, group: g})
+		}
+	}
+	return s
+}
+
+// Demand has a group of a controller read as soon as the bus is free
+func (s *Scheduler) Demand(e *Epever, g PollGroup) {
+	s.mu.Lock()
+	for _, j := range s.jobs {
+		if j.ep == e && j.group == g {
+			j.idle = false
+			j.next = time.Time{}
+		}
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run polls until the context is done
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		job, wait := s.due(time.Now())
+		if job != nil {
+			s.poll(ctx, job)
+			continue
+		}
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// due returns the first job due, in group order, or else how long until one
+// is, -1 if none ever will be without a demand
+func (s *Scheduler) due(now time.Time) (*pollJob, time.Duration) {
+	// Count the reconnects before taking the scheduler's mutex, so it is never
+	// held waiting for a bus. The jobs themselves never change.
+	reconnects := map[*Bus]int{}
+	for _, j := range s.jobs {
+		if _, ok := reconnects[j.ep.bus]; !ok {
+			reconnects[j.ep.bus] = j.ep.bus.reconnectCount()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := time.Duration(-1)
+	for _, j := range s.jobs {
+		if j.idle && reconnects[j.ep.bus] != j.reconnects {
+			j.idle = false
+			j.next = time.Time{}
+		}
+		if j.idle {
+			continue
+		}
+		if !now.Before(j.next) {
+			return j, 0
+		}
+		if d := j.next.Sub(now); wait < 0 || d < wait {
+			wait = d
+		}
+	}
+	return nil, wait
+}
+
+// poll reads one job's group and schedules its next read
+func (s *Scheduler) poll(ctx context.Context, j *pollJob) {
+	snapshot, err := j.ep.RefreshGroup(ctx, j.group)
+	reconnects := j.ep.bus.reconnectCount()
+
+	s.mu.Lock()
+	interval := s.Intervals[j.group]
+	switch {
+	case interval > 0:
+		j.next = time.Now().Add(interval)
+	case err != nil:
+		j.next = time.Now().Add(staticRetry)
+	default:
+		j.idle = true
+		j.reconnects = reconnects
+	}
+	s.mu.Unlock()
+
+	if s.OnRefresh != nil {
+		s.OnRefresh(j.ep, j.group, snapshot, err)
+	}
+}
@@ -0,0 +1,141 @@
+package epever
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPollGroup(t *testing.T) {
+	for name, want := range map[string]PollGroup{
+		"BatteryVoltage":            RealtimeGroup,
+		"BatteryNetCurrent":         RealtimeGroup,
+		"StatusChargingStatus":      StatusGroup,
+		"Night":                     StatusGroup,
+		"CoilManualLoad":            StatusGroup,
+		"HistGenerated":             StatsGroup,
+		"RTCsec":                    RTCGroup,
+		"RatedInputVoltage":         ConfigGroup,
+		"BatteryConfigBatteryType":  ConfigGroup,
+		"LoadNightThresholdVoltage": ConfigGroup,
+	} {
+		r, ok := LookupRegister(name)
+		if !ok {
+			t.Fatalf("no register %s", name)
+		}
+		if got := r.PollGroup(); got != want {
+			t.Errorf("%s is in the %s group, want %s", name, got, want)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	slave := newFakeSlave(1)
+	for _, blocks := range groupBlocks {
+		slave.fill(blocks)
+	}
+	slave.input[REGBatteryVoltage] = 2650
+
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t) + "?timeout=100ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+
+	var mu sync.Mutex
+	reads := map[PollGroup]int{}
+	refreshed := make(chan struct{}, 1)
+	s := NewScheduler([]*Epever{ep}, PollIntervals{RealtimeGroup: 10 * time.Millisecond})
+	s.OnRefresh = func(e *Epever, g PollGroup, snapshot Snapshot, err error) {
+		if err != nil {
+			t.Errorf("%s read failed: %v", g, err)
+		}
+		mu.Lock()
+		reads[g]++
+		mu.Unlock()
+		select {
+		case refreshed <- struct{}{}:
+		default:
+		}
+	}
+	count := func(g PollGroup) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return reads[g]
+	}
+	// waitFor waits for reads until the condition holds, or fails the test
+	// once they have stalled for a second
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for !cond() {
+			select {
+			case <-refreshed:
+			case <-time.After(time.Second):
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+	// Realtime reads go on at every interval, so a few more of them show that
+	// nothing else was read in the meantime
+	realtimeReads := func(n int) func() bool {
+		until := count(RealtimeGroup) + n
+		return func() bool { return count(RealtimeGroup) >= until }
+	}
+	static := []PollGroup{StatusGroup, StatsGroup, RTCGroup, ConfigGroup}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	waitFor("the first reads", func() bool {
+		for _, g := range static {
+			if count(g) == 0 {
+				return false
+			}
+		}
+		return true
+	})
+	waitFor("realtime reads", realtimeReads(3))
+	for _, g := range static {
+		if n := count(g); n != 1 {
+			t.Errorf("static %s group read %d times, want once", g, n)
+		}
+	}
+	if got := ep.Snapshot(); got.BatteryVoltage != 26.5 || got.Taken.IsZero() {
+		t.Errorf("snapshot has battery %v taken %v", got.BatteryVoltage, got.Taken)
+	}
+
+	// Static groups are read again after a reconnect, and on demand
+	ep.Close()
+	waitFor("config after a reconnect", func() bool { return count(ConfigGroup) >= 2 })
+	waitFor("realtime reads", realtimeReads(3))
+	if n := count(ConfigGroup); n != 2 {
+		t.Errorf("config read %d times after a reconnect, want 2", n)
+	}
+	s.Demand(ep, ConfigGroup)
+	waitFor("config on demand", func() bool { return count(ConfigGroup) >= 3 })
+	waitFor("realtime reads", realtimeReads(3))
+	if n := count(ConfigGroup); n != 3 {
+		t.Errorf("config read %d times after a demand, want 3", n)
+	}
+
+	// A timeout closes the connection to resync, which is not a reconnect
+	slave.mu.Lock()
+	slave.drop = 1
+	slave.mu.Unlock()
+	waitFor("the dropped request", func() bool {
+		slave.mu.Lock()
+		defer slave.mu.Unlock()
+		return slave.drop == 0
+	})
+	waitFor("realtime reads", realtimeReads(3))
+	if n := count(ConfigGroup); n != 3 {
+		t.Errorf("config read %d times after a timeout, want 3", n)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("run ended with %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package epever
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setField parses value into the field of a settings struct with the given
+// name, ignoring case. Enums take their names or numbers, times of day
+// hh:mm[:ss] and durations Go syntax like 5h30m.
+func setField(settings interface{}, name, value string) error {
+	f := reflect.ValueOf(settings).Elem().FieldByNameFunc(func(n string) bool { return strings.EqualFold(n, name) })
+	if !f.IsValid() {
+		return fmt.Errorf("%w: no setting named %q", ErrInvalidConfig, name)
+	}
+	if err := parseValue(f, value); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, name, err)
+	}
+	return nil
+}
+
+// parseValue sets f from its text form
+func parseValue(f reflect.Value, value string) error {
+	switch f.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	case TimeOfDay:
+		t, err := parseTimeOfDay(value)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int:
+		// Enums, which are named by their String()
+		if n, err := strconv.Atoi(value); err == nil {
+			f.SetInt(int64(n))
+			return nil
+		}
+		if _, ok := f.Interface().(fmt.Stringer); ok {
+			e := reflect.New(f.Type()).Elem()
+			for i := int64(0); i < 16; i++ {
+				e.SetInt(i)
+				if strings.EqualFold(e.Interface().(fmt.Stringer).String(), value) {
+					f.SetInt(i)
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("unknown value %q", value)
+	case reflect.Uint16:
+		n, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("can't set a %s", f.Type())
+	}
+	return nil
+}
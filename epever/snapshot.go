@@ -0,0 +1,192 @@
+package epever
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Snapshot holds every value decoded by a single Refresh. It contains no
+// references, so a copy handed out by the driver can never change underneath
+// the caller.
+type Snapshot struct {
+	Taken    time.Time // When the realtime values were read, zero if they haven't been
+	RTCTaken time.Time // When the clock was read
+
+	RatedInputVoltage float64
+	RatedInputCurrent float64
+	RatedInputPower   float64
+
+	RatedBatteryVoltage float64
+	RatedBatteryCurrent float64
+	RatedBatteryPower   float64
+
+	BatteryRealRatedVoltage float64
+
+	ChargeVoltage float64
+	ChargeCurrent float64
+	ChargePower   float64
+
+	BatteryVoltage float64
+	BatteryCurrent float64
+	BatteryPower   float64
+
+	LoadVoltage float64
+	LoadCurrent float64
+	LoadPower   float64
+
+	TempBattery  float64
+	TempInside   float64
+	TempHeatsink float64
+
+	OverTemp bool
+	Night    bool
+
+	BatteryPercent    float64
+	TempRemoteBattery float64
+
+	StatusBattery                   uint16
+	StatusBatteryWrongID            bool
+	StatusBatteryResistanceAbnormal bool
+	StatusBatteryTemp               StatusBatteryTempType
+	StatusBatteryVolt               StatusBatteryVoltType
+
+	StatusCharging                         uint16
+	StatusChargingRunning                  bool
+	StatusChargingStatus                   StatusChargingStatusType
+	StatusChargingLoadOpenCircuit          bool
+	StatusChargingLoadMosfetShort          bool
+	StatusChargingLoadShort                bool
+	StatusChargingLoadOverCurrent          bool
+	StatusChargingInputOverCurrent         bool
+	StatusChargingAntiReverseMosfetShort   bool
+	StatusChargingOrAntiReverseMosfetShort bool
+	StatusChargingMosfetShort              bool
+	StatusChargingInputVoltStatus          StatusChargingInputVoltStatusType
+
+	StatusDischarging                     uint16
+	StatusDischargingRunning              bool
+	StatusDischargingFault                bool
+	StatusDischargingOutputOverVoltage    bool
+	StatusDischargingBoostOverVoltage     bool
+	StatusDischargingHighVoltageSideShort bool
+	StatusDischargingInputOverVoltage     bool
+	StatusDischargingOutputVoltAbnormal   bool
+	StatusDischargingUnableToStop         bool
+	StatusDischargingUnableToDischarge    bool
+	StatusDischargingShortCircuit         bool
+	StatusDischargingOutputPower          StatusDischargingOutputPowerType
+	StatusDischargingInputVoltStatus      StatusDischargingInputVoltType
+
+	HistBatteryVoltageTodayMax float64
+	HistBatteryVoltageTodayMin float64
+	HistConsumedToday          float64
+	HistConsumedMonth          float64
+	HistConsumedYear           float64
+	HistConsumed               float64
+	HistGeneratedToday         float64
+	HistGeneratedMonth         float64
+	HistGeneratedYear          float64
+	HistGenerated              float64
+
+	BatteryNetVoltage float64
+	BatteryNetCurrent float64
+
+	BatteryConfigBatteryType uint16
+	BatteryConfigCapacity    uint16
+
+	BatteryConfigTempCoef                          float64
+	BatteryConfigOverVoltDisconnect                float64
+	BatteryConfigChargingLimitVoltage              float64
+	BatteryConfigOverVoltageReconnect              float64
+	BatteryConfigEqualizeChargingVoltage           float64
+	BatteryConfigBoostChargingVoltage              float64
+	BatteryConfigFloatChargingVoltage              float64
+	BatteryConfigBoostReconnectChargingVoltage     float64
+	BatteryConfigLowVoltageReconnectVoltage        float64
+	BatteryConfigUnderVoltageWarningRecoverVoltage float64
+	BatteryConfigUnderVoltageWarningVoltage        float64
+	BatteryConfigLowVoltageDisconnectVoltage       float64
+	BatteryConfigDischargingLimitVoltage           float64
+
+	BatteryConfigRatedVoltage     BatteryRatedVoltageType
+	BatteryConfigDischargePercent float64
+	BatteryConfigChargePercent    float64
+	BatteryConfigManagementMode   BatteryManagementModeType
+
+	BatteryConfigBatteryTempUpperLimit               float64
+	BatteryConfigBatteryTempLowerLimit               float64
+	BatteryConfigInnerTempUpperLimit                 float64
+	BatteryConfigInnerTempUpperLimitRecover          float64
+	BatteryConfigPowerComponentTempUpperLimit        float64
+	BatteryConfigPowerComponentTempUpperLimitRecover float64
+	BatteryConfigLineImpedance                       float64
+
+	ChargeEqualizationDuration uint16
+	ChargeBoostDuration        uint16
+	ChargeEqualizePeriodDays   uint16
+
+	LoadControlMode           LoadControlModeType
+	LoadNightThresholdVoltage float64
+	LoadLightOnDelay          uint16
+	LoadDayThresholdVoltage   float64
+	LoadLightOffDelay         uint16
+	LoadWorkingTime1Hour      uint16
+	LoadWorkingTime1Min       uint16
+	LoadWorkingTime2Hour      uint16
+	LoadWorkingTime2Min       uint16
+	LoadTurnOn1Hour           uint16
+	LoadTurnOn1Min            uint16
+	LoadTurnOn1Sec            uint16
+	LoadTurnOff1Hour          uint16
+	LoadTurnOff1Min           uint16
+	LoadTurnOff1Sec           uint16
+	LoadTurnOn2Hour           uint16
+	LoadTurnOn2Min            uint16
+	LoadTurnOn2Sec            uint16
+	LoadTurnOff2Hour          uint16
+	LoadTurnOff2Min           uint16
+	LoadTurnOff2Sec           uint16
+	LoadNightLengthHour       uint16
+	LoadNightLengthMin        uint16
+	LoadTimingSelection       LoadTimingSelectionType
+	LoadDefaultOn             bool
+
+	CoilChargingDevice      bool
+	CoilOutputControlManual bool
+	CoilManualLoad          bool
+	CoilDefaultLoad         bool
+	CoilLoadTestMode        bool
+	CoilForceLoad           bool
+
+	RTCsec   uint16
+	RTCmin   uint16
+	RTChour  uint16
+	RTCday   uint16
+	RTCmonth uint16
+	RTCyear  uint16
+}
+
+// Show this snapshot as a string, one group of registers per line in register map order
+func (s Snapshot) String() string {
+	var groups []string
+	lines := map[string][]string{}
+	for _, r := range Registers {
+		if r.Group == "" {
+			continue
+		}
+		if _, ok := lines[r.Group]; !ok {
+			groups = append(groups, r.Group)
+			lines[r.Group] = nil
+		}
+		if v := r.format(s); v != "" {
+			lines[r.Group] = append(lines[r.Group], v)
+		}
+	}
+
+	out := fmt.Sprintf("EPEVER RTC %4d-%2d-%2d %2d:%2d:%2d\n", s.RTCyear, s.RTCmonth, s.RTCday, s.RTChour, s.RTCmin, s.RTCsec)
+	for _, g := range groups {
+		out += g + " " + strings.Join(lines[g], " ") + "\n"
+	}
+	return out
+}
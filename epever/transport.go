@@ -0,0 +1,253 @@
+package epever
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Transport is the link to the controller, eg a serial port or a TCP gateway
+type Transport interface {
+	Connect() error
+	Close() error
+	// Client returns a modbus client talking to the given slave over this link
+	Client(slaveID byte) modbus.Client
+	String() string
+}
+
+// NewTransport creates a transport from an address such as
+//
+//	rtu:///dev/ttyXRUSB0?baud=115200
+//	tcp://host:502
+//	rtuovertcp://host:4001
+//
+// A plain device path is treated as rtu. tcp defaults to the Modbus port 502,
+// rtuovertcp has no standard port so it must be given. All schemes accept
+// timeout=10s.
+func NewTransport(address string) (Transport, error) {
+	if strings.HasPrefix(address, "/") {
+		address = "rtu://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("epever: bad address %q: %v", address, err)
+	}
+	q := u.Query()
+	timeout := defaultTimeout
+	if v := q.Get("timeout"); v != "" {
+		if timeout, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("epever: bad timeout %q: %v", v, err)
+		}
+	}
+
+	switch u.Scheme {
+	case "rtu":
+		return newRTUTransport(u.Path, q, timeout)
+	case "tcp", "rtuovertcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("epever: %s address %q has no host", u.Scheme, address)
+		}
+		host := u.Host
+		if u.Port() == "" {
+			if u.Scheme != "tcp" {
+				return nil, fmt.Errorf("epever: %s address %q has no port, eg %s://%s:4001", u.Scheme, address, u.Scheme, u.Host)
+			}
+			host = net.JoinHostPort(u.Hostname(), "502")
+		}
+		if u.Scheme == "tcp" {
+			h := modbus.NewTCPClientHandler(host)
+			h.Timeout = timeout
+			return &tcpTransport{handler: h}, nil
+		}
+		return &rtuOverTCPTransport{address: host, timeout: timeout}, nil
+	}
+	return nil, fmt.Errorf("epever: unknown scheme %q in %q, want rtu, tcp or rtuovertcp", u.Scheme, address)
+}
+
+// rtuTransport is a local serial port
+type rtuTransport struct {
+	handler *modbus.RTUClientHandler
+}
+
+func newRTUTransport(device string, q url.Values, timeout time.Duration) (*rtuTransport, error) {
+	if device == "" {
+		return nil, fmt.Errorf("epever: rtu address has no device")
+	}
+	h := modbus.NewRTUClientHandler(device)
+	h.BaudRate = 115200
+	h.DataBits = 8
+	h.Parity = "N"
+	h.StopBits = 1
+	h.Timeout = timeout
+
+	for _, p := range []struct {
+		name string
+		val  *int
+	}{{"baud", &h.BaudRate}, {"databits", &h.DataBits}, {"stopbits", &h.StopBits}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("epever: bad %s %q", p.name, v)
+			}
+			*p.val = n
+		}
+	}
+	if v := q.Get("parity"); v != "" {
+		v = strings.ToUpper(v)
+		if v != "N" && v != "E" && v != "O" {
+			return nil, fmt.Errorf("epever: bad parity %q, want N, E or O", v)
+		}
+		h.Parity = v
+	}
+	return &rtuTransport{handler: h}, nil
+}
+
+func (t *rtuTransport) Connect() error { return t.handler.Connect() }
+func (t *rtuTransport) Close() error   { return t.handler.Close() }
+func (t *rtuTransport) String() string { return "rtu://" + t.handler.Address }
+
+func (t *rtuTransport) Client(slaveID byte) modbus.Client {
+	// Only the packager half of this handler is used, it holds the slave id
+	packager := modbus.NewRTUClientHandler(t.handler.Address)
+	packager.SlaveId = slaveID
+	return modbus.NewClient2(packager, t.handler)
+}
+
+// tcpTransport is a Modbus TCP gateway such as an eBox-WIFI
+type tcpTransport struct {
+	handler *modbus.TCPClientHandler
+}
+
+func (t *tcpTransport) Connect() error { return t.handler.Connect() }
+func (t *tcpTransport) Close() error   { return t.handler.Close() }
+func (t *tcpTransport) String() string { return "tcp://" + t.handler.Address }
+
+func (t *tcpTransport) Client(slaveID byte) modbus.Client {
+	packager := modbus.NewTCPClientHandler(t.handler.Address)
+	packager.SlaveId = slaveID
+	return modbus.NewClient2(packager, t.handler)
+}
+
+// rtuOverTCPTransport sends raw RTU frames over a TCP stream, eg ser2net
+type rtuOverTCPTransport struct {
+	address string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (t *rtuOverTCPTransport) String() string { return "rtuovertcp://" + t.address }
+
+func (t *rtuOverTCPTransport) Connect() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connect()
+}
+
+func (t *rtuOverTCPTransport) connect() error {
+	if t.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", t.address, t.timeout)
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+	return nil
+}
+
+func (t *rtuOverTCPTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.close()
+}
+
+func (t *rtuOverTCPTransport) close() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+func (t *rtuOverTCPTransport) Client(slaveID byte) modbus.Client {
+	packager := modbus.NewRTUClientHandler(t.address)
+	packager.SlaveId = slaveID
+	return modbus.NewClient2(packager, t)
+}
+
+// Send writes one RTU frame and reads back the response frame
+func (t *rtuOverTCPTransport) Send(aduRequest []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.connect(); err != nil {
+		return nil, err
+	}
+	aduResponse, err := t.send(aduRequest)
+	if err != nil {
+		// A half read frame would desync the stream, so start again
+		t.close()
+	}
+	return aduResponse, err
+}
+
+func (t *rtuOverTCPTransport) send(aduRequest []byte) ([]byte, error) {
+	if t.timeout > 0 {
+		if err := t.conn.SetDeadline(time.Now().Add(t.timeout)); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := t.conn.Write(aduRequest); err != nil {
+		return nil, err
+	}
+
+	// Slave id and function code
+	header := make([]byte, 2, 256)
+	if _, err := io.ReadFull(t.conn, header); err != nil {
+		return nil, err
+	}
+	var remaining int
+	function := header[1]
+	switch {
+	case function&0x80 != 0:
+		remaining = 3 // exception code + crc
+	case function == modbus.FuncCodeReadCoils,
+		function == modbus.FuncCodeReadDiscreteInputs,
+		function == modbus.FuncCodeReadInputRegisters,
+		function == modbus.FuncCodeReadHoldingRegisters,
+		function == modbus.FuncCodeReadWriteMultipleRegisters:
+		count := make([]byte, 1)
+		if _, err := io.ReadFull(t.conn, count); err != nil {
+			return nil, err
+		}
+		header = append(header, count[0])
+		remaining = int(count[0]) + 2
+	case function == modbus.FuncCodeWriteSingleCoil,
+		function == modbus.FuncCodeWriteMultipleCoils,
+		function == modbus.FuncCodeWriteSingleRegister,
+		function == modbus.FuncCodeWriteMultipleRegisters:
+		remaining = 6
+	case function == modbus.FuncCodeMaskWriteRegister:
+		remaining = 8
+	default:
+		return nil, fmt.Errorf("modbus: response function code '%v' does not match request '%v'", function, aduRequest[1])
+	}
+
+	rest := make([]byte, remaining)
+	if _, err := io.ReadFull(t.conn, rest); err != nil {
+		return nil, err
+	}
+	return append(header, rest...), nil
+}
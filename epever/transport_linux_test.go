@@ -0,0 +1,50 @@
+package epever
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// openPty returns the master side of a new pseudo terminal and the slave's path
+func openPty(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pty available: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	var unlock int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		t.Skipf("unlockpt: %v", errno)
+	}
+	var n uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		t.Skipf("ptsname: %v", errno)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+func TestRTUTransportLoopback(t *testing.T) {
+	master, device := openPty(t)
+	slave := newFakeSlave(1)
+	slave.input[REGTempBattery] = 1723
+	go func() {
+		for slave.answerRTU(master) == nil {
+		}
+	}()
+
+	ep, err := NewEpever("rtu://" + device + "?baud=115200&timeout=2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+
+	data, err := ep.readWithRetry(context.Background(), REGTempBattery, 1)
+	if err != nil || len(data) != 2 || uint16(data[0])<<8|uint16(data[1]) != 1723 {
+		t.Errorf("got % x, %v", data, err)
+	}
+}
@@ -0,0 +1,77 @@
+package epever
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNewTransport(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		want    string
+		err     bool
+	}{
+		{"/dev/ttyXRUSB0", "rtu:///dev/ttyXRUSB0", false},
+		{"rtu:///dev/ttyUSB1?baud=9600&parity=e", "rtu:///dev/ttyUSB1", false},
+		{"tcp://192.168.1.20", "tcp://192.168.1.20:502", false},
+		{"tcp://[::1]", "tcp://[::1]:502", false},
+		{"tcp://[fe80::1]:1502", "tcp://[fe80::1]:1502", false},
+		{"rtuovertcp://gateway:4001?timeout=2s", "rtuovertcp://gateway:4001", false},
+		{"rtuovertcp://gateway", "", true},
+		{"rtu:///dev/ttyUSB1?baud=fast", "", true},
+		{"rtu:///dev/ttyUSB1?parity=x", "", true},
+		{"tcp://host?timeout=soon", "", true},
+		{"tcp:///nohost", "", true},
+		{"udp://host:502", "", true},
+	} {
+		tr, err := NewTransport(tc.address)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.address)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.address, err)
+			continue
+		}
+		if tr.String() != tc.want {
+			t.Errorf("%s: got %s want %s", tc.address, tr, tc.want)
+		}
+	}
+}
+
+func TestTransportsLoopback(t *testing.T) {
+	slave := newFakeSlave(1)
+	slave.input[REGBatteryVoltage] = 2534
+	slave.holding[REGBatteryCapacity] = 200
+
+	for _, address := range []string{
+		"tcp://" + slave.serveTCP(t),
+		"rtuovertcp://" + slave.serveRTU(t),
+	} {
+		ep, err := NewEpever(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+
+		data, err := ep.readWithRetry(ctx, REGBatteryVoltage, 1)
+		if err != nil || len(data) != 2 || data[0] != 2534>>8 || data[1] != 2534&0xff {
+			t.Errorf("%s: input read got % x, %v", address, data, err)
+		}
+		data, err = ep.readHoldingWithRetry(ctx, REGBatteryCapacity, 1)
+		if err != nil || len(data) != 2 || data[1] != 200 {
+			t.Errorf("%s: holding read got % x, %v", address, data, err)
+		}
+
+		// The fake slave answers unknown registers with an illegal address exception
+		_, err = ep.readWithRetry(ctx, 0x3333, 1)
+		var readErr *ReadError
+		if !errors.As(err, &readErr) || !errors.Is(err, ErrException) || readErr.Attempts != 1 {
+			t.Errorf("%s: expected a single exception attempt, got %v", address, err)
+		}
+		ep.Close()
+	}
+}
@@ -0,0 +1,247 @@
+package epever
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// WritePolicy controls how settings and coils are written
+type WritePolicy struct {
+	DryRun bool      // Read and log the changes but write nothing
+	Audit  io.Writer // Gets a line for every register changed, rolled back or left alone by a dry run
+}
+
+// regWrite is one request of a change: a run of holding registers, or a single coil
+type regWrite struct {
+	table   Table
+	address uint16
+	words   []uint16                 // Register contents, or 0/1 for a coil
+	verify  func(got []uint16) error // Checks the contents read back, nil to require exactly what was written
+	keep    bool                     // Not rolled back, eg the clock, whose old value is stale by then
+}
+
+// blockWrite is the write of a block of holding registers from snapshot values
+func blockWrite(b block, s Snapshot) regWrite {
+	data := b.encode(s)
+	w := regWrite{table: HoldingRegister, address: b.address, words: make([]uint16, b.quantity)}
+	for i := range w.words {
+		w.words[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return w
+}
+
+// coilWrite is the write of one coil
+func coilWrite(address uint16, on bool) regWrite {
+	return regWrite{table: Coil, address: address, words: []uint16{uint16(boolRaw(on))}}
+}
+
+// block describes the registers the write covers, for decoding and naming them
+func (w regWrite) block() block {
+	n := uint16(len(w.words))
+	return block{table: w.table, address: w.address, quantity: n, regs: registersIn(w.table, w.address, w.address+n-1)}
+}
+
+// commit is the single path every write takes. The registers are read first
+// to capture their old values, then each write is sent, read back and
+// verified. If any fails, the ones before it and the failed one are rolled
+// back to the captured values. Unchanged writes are skipped, and with
+// DryRun nothing is written. Changes are logged to the audit writer.
+// Caller must hold the bus mutex.
+func (e *Epever) commit(ctx context.Context, writes []regWrite) error {
+	old := make([][]uint16, len(writes))
+	for i, w := range writes {
+		words, err := e.readWords(ctx, w.table, w.address, uint16(len(w.words)))
+		if err != nil {
+			return asWriteError(err)
+		}
+		old[i] = words
+	}
+
+	for i, w := range writes {
+		if equalWords(old[i], w.words) {
+			continue
+		}
+		if e.Writes.DryRun {
+			e.audit(w, old[i], w.words, "dry run")
+			continue
+		}
+		if err := e.writeVerify(ctx, w); err != nil {
+			e.audit(w, old[i], w.words, "failed: "+err.Error())
+			return e.rollback(ctx, writes[:i+1], old[:i+1], err)
+		}
+		e.audit(w, old[i], w.words, "written")
+	}
+	return nil
+}
+
+// rollback writes the captured values back, last first, after err
+func (e *Epever) rollback(ctx context.Context, writes []regWrite, old [][]uint16, err error) error {
+	var failed []string
+	for i := len(writes) - 1; i >= 0; i-- {
+		w := writes[i]
+		if w.keep || equalWords(old[i], w.words) {
+			continue
+		}
+		back := regWrite{table: w.table, address: w.address, words: old[i]}
+		if rerr := e.writeVerify(ctx, back); rerr != nil {
+			e.audit(back, w.words, old[i], "rollback failed: "+rerr.Error())
+			failed = append(failed, fmt.Sprintf("0x%04x", w.address))
+			continue
+		}
+		e.audit(back, w.words, old[i], "rolled back")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%w (rollback of %s failed too)", err, strings.Join(failed, ", "))
+	}
+	return err
+}
+
+// writeVerify sends one write, reads it back and checks it, decoding what
+// was read into the snapshot. Caller must hold the bus mutex.
+func (e *Epever) writeVerify(ctx context.Context, w regWrite) error {
+	quantity := uint16(len(w.words))
+	err := e.write(ctx, w.table, w.address, quantity, func(c modbus.Client) ([]byte, error) {
+		if w.table == Coil {
+			value := uint16(0x0000)
+			if w.words[0] != 0 {
+				value = 0xff00
+			}
+			return c.WriteSingleCoil(w.address, value)
+		}
+		return c.WriteMultipleRegisters(w.address, quantity, wordsData(w.words))
+	})
+	if err != nil {
+		return err
+	}
+
+	got, err := e.readWords(ctx, w.table, w.address, quantity)
+	if err != nil {
+		return asWriteError(err)
+	}
+	if w.verify != nil {
+		err = w.verify(got)
+	} else if !equalWords(got, w.words) {
+		err = fmt.Errorf("%s", w.block().differences(w.words, got))
+	}
+	if err != nil {
+		return &WriteError{Address: w.address, Quantity: quantity, Attempts: 1, Class: ClassVerify, Err: err}
+	}
+	return nil
+}
+
+// readWords reads registers or coils, coils as 0/1, and decodes them into
+// the snapshot. Caller must hold the bus mutex.
+func (e *Epever) readWords(ctx context.Context, table Table, address, quantity uint16) ([]uint16, error) {
+	data, err := e.readTable(ctx, table, address, quantity)
+	if err != nil {
+		return nil, err
+	}
+	b := regWrite{table: table, address: address, words: make([]uint16, quantity)}.block()
+	words := make([]uint16, quantity)
+	for i := range words {
+		if table == Coil || table == DiscreteInput {
+			if len(data) <= i/8 {
+				return nil, &ReadError{Address: address, Quantity: quantity, Attempts: 1, Class: ClassCRC, Err: fmt.Errorf("short response")}
+			}
+			words[i] = uint16(data[i/8]>>(i%8)) & 1
+		} else {
+			words[i] = binary.BigEndian.Uint16(data[2*i:])
+		}
+	}
+	e.decodeSnapshot(b, data)
+	return words, nil
+}
+
+// differences names the registers whose contents read back differ from those written
+func (b block) differences(want, got []uint16) string {
+	var wrote, read Snapshot
+	b.decodeWords(&wrote, want)
+	b.decodeWords(&read, got)
+	var differ []string
+	for _, r := range b.regs {
+		if r.Value(wrote) != r.Value(read) {
+			differ = append(differ, fmt.Sprintf("%s wrote %v read %v", r.Name, r.Value(wrote), r.Value(read)))
+		}
+	}
+	if len(differ) == 0 {
+		return fmt.Sprintf("wrote %v read %v", want, got)
+	}
+	return strings.Join(differ, ", ")
+}
+
+// decodeWords decodes register contents, or coils as 0/1, into the snapshot
+func (b block) decodeWords(s *Snapshot, words []uint16) {
+	if b.table == Coil || b.table == DiscreteInput {
+		data := make([]byte, (len(words)+7)/8)
+		for i, w := range words {
+			data[i/8] |= byte(w&1) << (i % 8)
+		}
+		b.decode(s, data)
+		return
+	}
+	b.decode(s, wordsData(words))
+}
+
+// audit logs each register of the write whose contents change
+func (e *Epever) audit(w regWrite, from, to []uint16, outcome string) {
+	if e.Writes.Audit == nil {
+		return
+	}
+	for i := range to {
+		if from[i] == to[i] {
+			continue
+		}
+		address := w.address + uint16(i)
+		fmt.Fprintf(e.Writes.Audit, "%s %s %s 0x%04x %s %d -> %d %s\n",
+			time.Now().Format(time.RFC3339), e.Name(), w.table, address, registerNames(w.table, address), from[i], to[i], outcome)
+	}
+}
+
+// registerNames lists the register map entries at an address
+func registerNames(table Table, address uint16) string {
+	var names []string
+	for _, r := range registersIn(table, address, address) {
+		names = append(names, r.Name)
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
+
+// asWriteError turns a failed read made while writing into a WriteError, so
+// every write API fails with the one type
+func asWriteError(err error) error {
+	var readErr *ReadError
+	if errors.As(err, &readErr) {
+		return &WriteError{Address: readErr.Address, Quantity: readErr.Quantity, Attempts: readErr.Attempts, Class: readErr.Class, Err: readErr}
+	}
+	return err
+}
+
+func wordsData(words []uint16) []byte {
+	data := make([]byte, 2*len(words))
+	for i, w := range words {
+		binary.BigEndian.PutUint16(data[2*i:], w)
+	}
+	return data
+}
+
+func equalWords(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
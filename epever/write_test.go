@@ -0,0 +1,69 @@
+package epever
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCommitRollback(t *testing.T) {
+	slave := newFakeSlave(1)
+	for _, b := range loadConfigBlocks {
+		for a := b.address; a < b.address+b.quantity; a++ {
+			slave.holding[a] = 0
+		}
+	}
+	slave.holding[REGDayTimeThresholdVolt] = 600
+	ep, err := NewEpever("tcp://" + slave.serveTCP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Close()
+	ctx := context.Background()
+	var audit bytes.Buffer
+	ep.Writes.Audit = &audit
+
+	c, err := ep.ReadLoadConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.NightThresholdVoltage = 5
+	c.TurnOn1 = TimeOfDay{18, 30, 0}
+
+	// The first block takes, the timer block doesn't, so both are put back
+	slave.ignoreWritesAt[REGLoadTurnOn1Sec] = true
+	err = ep.SetLoadConfig(ctx, c)
+	if !errors.Is(err, ErrVerify) {
+		t.Fatalf("expected a verify error, got %v", err)
+	}
+	if got := slave.holding[REGNightTimeThresholdVolt]; got != 0 {
+		t.Errorf("night threshold holds %d after rollback", got)
+	}
+	log := audit.String()
+	for _, want := range []string{
+		"LoadNightThresholdVoltage 0 -> 500 written",
+		"LoadTurnOn1Min 0 -> 30 failed",
+		"LoadNightThresholdVoltage 500 -> 0 rolled back",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("audit log lacks %q:\n%s", want, log)
+		}
+	}
+
+	// A dry run logs the change and writes nothing
+	slave.ignoreWritesAt[REGLoadTurnOn1Sec] = false
+	ep.Writes.DryRun = true
+	audit.Reset()
+	requests := slave.requests
+	if err := ep.SetLoadConfig(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if got := slave.requests - requests; got != len(loadConfigBlocks) {
+		t.Errorf("dry run made %d requests, want %d reads", got, len(loadConfigBlocks))
+	}
+	if slave.holding[REGNightTimeThresholdVolt] != 0 || !strings.Contains(audit.String(), "0 -> 500 dry run") {
+		t.Errorf("dry run wrote the controller or didn't log:\n%s", audit.String())
+	}
+}
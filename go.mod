@@ -3,8 +3,9 @@ module solar
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/goburrow/modbus v0.1.0
-	github.com/goburrow/serial v0.1.0 // indirect
-	github.com/golang/protobuf v1.5.2 // indirect
-	github.com/prometheus/client_golang v1.12.1 // indirect
+	github.com/goburrow/serial v0.1.0
+	github.com/prometheus/client_golang v1.12.1
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -1,49 +1,286 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
+	"solar/epever"
+
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// Some configuration consts we'll expose as metrics alongside the epever metrics
-const SOLAR_CONFIG_PANEL_NUM = 6
-const SOLAR_CONFIG_MAX_POWER = 600
-const SOLAR_CONFIG_BATTERY_NUM = 4
+// timezone the controller clocks are kept in
+var timezone = time.Local
 
-const PROMETHEUS_PORT = 2112
-const UPDATE_PERIOD = 1 * time.Minute
+// updatePeriod is how often the controllers are shown, their clocks synced
+// and their settings checked. It also bounds one shot commands.
+var updatePeriod = time.Minute
 
 // main
 func main() {
+	cfg := defaultConfig()
+	configFile := flag.String("config", "", "Yaml or toml file of the ports, controllers, site and exporters, see README")
+	address := flag.String("address", "/dev/ttyXRUSB0", "Controller address, eg rtu:///dev/ttyXRUSB0?baud=115200, tcp://host:502 or rtuovertcp://host:4001. Replaces the ports of -config")
+	slaves := flag.String("slaves", "1", "Comma separated slave ids on the bus, each optionally named, eg 1=house,2=shed. Replaces the ports of -config")
+	flag.StringVar(&cfg.Timezone, "timezone", cfg.Timezone, "Timezone the controller clocks are kept in, eg Pacific/Auckland")
+	flag.Var(&cfg.UpdatePeriod, "update-period", "Show the controllers, sync their clocks and check their settings this often")
+	flag.Var(&cfg.SyncRTC, "sync-rtc", "Set the controller clocks from the host this often while monitoring, 0 to never")
+	flag.StringVar(&cfg.Desired, "desired", cfg.Desired, "Json or yaml file of the settings every controller should have, checked every update period")
+	flag.BoolVar(&cfg.Enforce, "enforce", cfg.Enforce, "Write back settings that drifted from -desired")
+	flag.BoolVar(&cfg.DryRun, "dry-run", cfg.DryRun, "Read and show the changes any command or -enforce would write, without writing them")
+	flag.StringVar(&cfg.Audit, "audit", cfg.Audit, "File every register written or rolled back is appended to")
+	flag.StringVar(&cfg.Exporters.Prometheus.Listen, "listen", cfg.Exporters.Prometheus.Listen, "Address the prometheus metrics are served on, empty for none")
+	flag.BoolVar(&cfg.Exporters.Prometheus.LegacyMetrics, "legacy-metrics", cfg.Exporters.Prometheus.LegacyMetrics, "Also export the metrics under their old names, for dashboards that still use them")
+	flag.IntVar(&cfg.Exporters.Prometheus.StalePolls, "stale-polls", cfg.Exporters.Prometheus.StalePolls, "Stop exporting a controller's values once they are this many realtime polls old, 0 to never")
+	poll := flag.String("poll", "", "Poll intervals by group, eg realtime=5s,status=15s,stats=1m,rtc=1h,config=0. 0 reads a group only at start, on reconnect and when needed")
+	flag.Usage = usage
 
-	ep := NewEpever("/dev/ttyXRUSB0")
+	set, err := parseConfig(flag.CommandLine, os.Args[1:], &cfg, configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if set["address"] || set["slaves"] {
+		devices, err := parseDevices(*slaves)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		cfg.Ports = []portConfig{{Address: *address, Devices: devices}}
+	}
+	if *poll != "" {
+		if err := parsePollIntervals(cfg.Poll, *poll); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
 
-	// Setup prometheus
-	http.Handle("/metrics", promhttp.Handler())
-	go http.ListenAndServe(fmt.Sprintf(":%d", PROMETHEUS_PORT), nil)
+	timezone, _ = time.LoadLocation(cfg.Timezone)
+	updatePeriod = time.Duration(cfg.UpdatePeriod)
 
-	fmt.Printf("Listening on port %d...\n", PROMETHEUS_PORT)
+	var desired epever.DesiredState
+	if cfg.Desired != "" {
+		if desired, err = loadDesiredState(cfg.Desired); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cfg.Desired, err)
+			os.Exit(2)
+		}
+	}
 
-	// periodically update the prometheus regs
-	ticker := time.NewTicker(UPDATE_PERIOD)
+	eps, err := cfg.controllers()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	writes, err := writePolicy(cfg.DryRun, cfg.Audit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	for _, ep := range eps {
+		ep.Writes = writes
+	}
 
-	err := ep.Refresh()
-	fmt.Printf("Epever %v %v\n", err, ep)
+	switch cmd := flag.Arg(0); cmd {
+	case "", "monitor":
+		err := monitor(eps, monitorOptions{intervals: cfg.intervals(), syncRTC: time.Duration(cfg.SyncRTC), desired: desired,
+			enforce: cfg.Enforce, site: cfg.Site, prometheus: cfg.Exporters.Prometheus, staleAfter: cfg.staleAfter(),
+			console: cfg.Exporters.Console.Enabled})
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	default:
+		c, ok := commands[cmd]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if len(eps) != 1 {
+			fmt.Fprintf(os.Stderr, "%s works on one controller, pick it with -slaves\n", cmd)
+			os.Exit(2)
+		}
+		if err := c.run(eps[0], flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// writePolicy opens the audit file for appending. A dry run shows its changes
+// on stdout too, as that is the point of it.
+func writePolicy(dryRun bool, auditFile string) (epever.WritePolicy, error) {
+	var audit []io.Writer
+	if auditFile != "" {
+		f, err := os.OpenFile(auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return epever.WritePolicy{}, err
+		}
+		audit = append(audit, f)
+	}
+	if dryRun {
+		audit = append(audit, os.Stdout)
+	}
+	policy := epever.WritePolicy{DryRun: dryRun}
+	if len(audit) > 0 {
+		policy.Audit = io.MultiWriter(audit...)
+	}
+	return policy, nil
+}
 
+// monitorOptions are the optional jobs done while monitoring
+type monitorOptions struct {
+	intervals epever.PollIntervals // How often each group of registers is read
+	syncRTC   time.Duration        // Set the controller clocks this often, 0 to never
+	desired   epever.DesiredState  // Settings checked on each update period
+	enforce   bool                 // Write back settings that drifted from desired
+
+	site       siteConfig       // Exported alongside the controllers
+	prometheus prometheusConfig // Where and how the metrics are served
+	staleAfter time.Duration    // Age at which a controller's values stop being exported, 0 for never
+	console    bool             // Print every controller each update period
+}
+
+// monitor polls every controller on its schedule and exports the values to
+// prometheus. Once per update period it shows each controller, syncs the
+// clocks if asked to and rereads the settings to check them against desired.
+// It only returns if the metrics can't be served.
+func monitor(eps []*epever.Epever, opts monitorOptions) error {
+	// Setup prometheus
+	metrics := newCollector(opts.prometheus.LegacyMetrics, opts.staleAfter, opts.site)
+	prometheus.MustRegister(metrics)
+	for _, ep := range eps {
+		ep.Observer = metrics
+	}
+	served := make(chan error, 1)
+	if opts.prometheus.Listen != "" {
+		l, err := net.Listen("tcp", opts.prometheus.Listen)
+		if err != nil {
+			return err
+		}
+		http.Handle("/metrics", promhttp.Handler())
+		go func() { served <- http.Serve(l, nil) }()
+
+		fmt.Printf("Listening on %s...\n", l.Addr())
+	}
+
+	// One scheduler per bus, so separate buses are polled side by side
+	onRefresh := func(ep *epever.Epever, g epever.PollGroup, snapshot epever.Snapshot, err error) {
+		if g == epever.RealtimeGroup {
+			metrics.setUp(ep, err == nil)
+		}
+		if err != nil {
+			fmt.Printf("Epever %s %s refresh failed: %v\n", ep.Name(), g, err)
+			return
+		}
+		metrics.update(ep, snapshot)
+		if g == epever.ConfigGroup && opts.desired != nil {
+			checkDesired(metrics, ep, snapshot, opts.desired, opts.enforce)
+		}
+	}
+	schedulers := map[*epever.Epever]*epever.Scheduler{}
+	for _, busEps := range byBus(eps) {
+		scheduler := epever.NewScheduler(busEps, opts.intervals)
+		scheduler.OnRefresh = onRefresh
+		for _, ep := range busEps {
+			schedulers[ep] = scheduler
+		}
+		go scheduler.Run(context.Background())
+	}
+
+	ticker := time.NewTicker(updatePeriod)
+	lastSync := map[*epever.Epever]time.Time{}
 	for {
 		select {
+		case err := <-served:
+			return err
 		case <-ticker.C:
-			err := ep.Refresh()
-			fmt.Printf("Epever %v %v\n", err, ep)
-			ep.PushMetrics()
-			// Push some statics metrics as well
-			solarConfigNum.Set(SOLAR_CONFIG_PANEL_NUM)
-			solarConfigTotalPower.Set(SOLAR_CONFIG_MAX_POWER)
-			solarConfigBatteryNum.Set(SOLAR_CONFIG_BATTERY_NUM)
 		}
+		for _, ep := range eps {
+			if opts.console {
+				fmt.Printf("Epever %s %v\n", ep.Name(), ep)
+			}
+			if opts.syncRTC > 0 && time.Since(lastSync[ep]) >= opts.syncRTC {
+				if err := setRTC(ep); err != nil {
+					fmt.Printf("Epever %s clock not set: %v\n", ep.Name(), err)
+				} else {
+					lastSync[ep] = time.Now()
+					schedulers[ep].Demand(ep, epever.RTCGroup)
+				}
+			}
+			if opts.desired != nil {
+				schedulers[ep].Demand(ep, epever.ConfigGroup)
+			}
+		}
+	}
+}
+
+// byBus groups controllers by the bus they are on, in the order given
+func byBus(eps []*epever.Epever) [][]*epever.Epever {
+	var groups [][]*epever.Epever
+	index := map[*epever.Bus]int{}
+	for _, ep := range eps {
+		i, ok := index[ep.Bus()]
+		if !ok {
+			i = len(groups)
+			index[ep.Bus()] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], ep)
+	}
+	return groups
+}
+
+// hostTime is the host clock in the controllers' timezone
+func hostTime() time.Time {
+	return time.Now().In(timezone)
+}
+
+// setRTC sets the controller clock from the host clock
+func setRTC(ep *epever.Epever) error {
+	ctx, cancel := context.WithTimeout(context.Background(), updatePeriod)
+	defer cancel()
+	_, err := ep.SetRTC(ctx, hostTime)
+	return err
+}
+
+// loadDesiredState reads the desired settings file, json or yaml by its name
+func loadDesiredState(file string) (epever.DesiredState, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
 	}
+	return epever.UnmarshalDesiredState(data, backupFormat(file))
+}
 
+// checkDesired exports and logs how the controller's settings drifted from
+// the desired state, and writes the desired values back if enforcing
+func checkDesired(metrics *collector, ep *epever.Epever, s epever.Snapshot, desired epever.DesiredState, enforce bool) {
+	drifts := desired.Drift(s)
+	metrics.updateDrift(ep, s, desired)
+	for _, d := range drifts {
+		fmt.Printf("Epever %s config drift: %v\n", ep.Name(), d)
+	}
+	if !enforce || len(drifts) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), updatePeriod)
+	defer cancel()
+	if _, err := ep.EnforceDesiredState(ctx, desired); err != nil {
+		fmt.Printf("Epever %s config not enforced: %v\n", ep.Name(), err)
+		return
+	}
+	fmt.Printf("Epever %s config enforced\n", ep.Name())
+	metrics.updateDrift(ep, ep.Snapshot(), desired)
 }
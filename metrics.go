@@ -0,0 +1,313 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"solar/epever"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Labels that tell controllers apart when several share one exporter
+var deviceLabels = []string{"device", "slave_id", "name"}
+
+// registerDesc is the metric exported for one entry of the register map
+type registerDesc struct {
+	reg       epever.Register
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	legacy    *prometheus.Desc // Under the name before the conventions, nil if it didn't change
+	stateSet  *prometheus.Desc // A series per state of an enum, nil if it isn't one
+	states    []string
+}
+
+// Prometheus metrics, one per register in the map that names a metric
+var registerDescs = newRegisterDescs(epever.Registers)
+
+func newRegisterDescs(regs []epever.Register) []registerDesc {
+	var descs []registerDesc
+	for _, r := range regs {
+		if r.Metric == "" {
+			continue
+		}
+		d := registerDesc{reg: r, desc: prometheus.NewDesc(r.Metric, r.Help, deviceLabels, nil), valueType: prometheus.GaugeValue}
+		if strings.HasSuffix(r.Metric, "_total") {
+			d.valueType = prometheus.CounterValue
+		}
+		if r.Legacy != "" {
+			d.legacy = prometheus.NewDesc(r.Legacy, r.Help, deviceLabels, nil)
+		}
+		if r.StateSet != "" {
+			d.stateSet = prometheus.NewDesc(r.StateSet, r.Help+", 1 for the current state",
+				append([]string{"state"}, deviceLabels...), nil)
+			d.states = r.States()
+		}
+		descs = append(descs, d)
+	}
+	return descs
+}
+
+var (
+	// Controller clock drift, controller minus host
+	solarRTCDrift = prometheus.NewDesc("solar_rtc_drift_seconds",
+		"Controller clock minus host clock in seconds", deviceLabels, nil)
+
+	// Load timer settings that are times, as seconds (since midnight for the turn on/off times)
+	solarLoadConfigSeconds = prometheus.NewDesc("solar_load_config_seconds",
+		"Config load timer lengths and turn on/off times of day in seconds", append([]string{"setting"}, deviceLabels...), nil)
+
+	// Settings that differ from the desired state
+	solarConfigDrift = prometheus.NewDesc("solar_config_drift",
+		"Controller setting minus its desired value, 0 when it matches", append([]string{"register"}, deviceLabels...), nil)
+
+	// Poll health
+	solarUp = prometheus.NewDesc("solar_up",
+		"1 if the last refresh of the controller succeeded and its data is fresh, 0 otherwise", deviceLabels, nil)
+	solarLastRefresh = prometheus.NewDesc("solar_last_successful_refresh_timestamp_seconds",
+		"Unix time of the last successful refresh of the controller", deviceLabels, nil)
+
+	// The controller model, as the value 1
+	solarControllerInfo = prometheus.NewDesc("solar_controller_info",
+		"Controller model from its ratings", append([]string{"model"}, deviceLabels...), nil)
+)
+
+// Site configuration metrics
+var (
+	solarConfigPanels     = prometheus.NewDesc("solar_config_panels", "Number of panels", nil, nil)
+	solarConfigPowerWatts = prometheus.NewDesc("solar_config_max_power_watts", "Total max power of the panels", nil, nil)
+	solarConfigBatteries  = prometheus.NewDesc("solar_config_batteries", "Number of batteries", nil, nil)
+
+	// The same under their legacy names
+	solarConfigNum        = prometheus.NewDesc("solar_config_num", "Number of panels", nil, nil)
+	solarConfigTotalPower = prometheus.NewDesc("solar_config_total_power", "Total max power", nil, nil)
+	solarConfigBatteryNum = prometheus.NewDesc("solar_config_battery_num", "Number of batteries", nil, nil)
+)
+
+// collector exports the most recent snapshot of every controller, labelled
+// for the controller, so any number of them on any number of buses share one
+// endpoint. Controllers appear once they have been polled, and their values
+// once they have been refreshed. Values older than staleAfter are dropped, so
+// a stalled poll shows as missing data rather than as flat lines.
+// It is also the controllers' epever.Observer, counting the requests made on
+// the buses.
+type collector struct {
+	legacy     bool          // Also export the metrics under their names from before the Prometheus conventions
+	staleAfter time.Duration // Age at which a snapshot is no longer exported, 0 for never
+	site       siteConfig    // Exported as the solar_config_* metrics
+
+	mu      sync.Mutex
+	order   []*epever.Epever
+	devices map[*epever.Epever]*deviceMetrics
+
+	// Modbus transport metrics
+	attempts   *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+	reconnects *prometheus.CounterVec
+}
+
+// deviceMetrics is what was last seen of one controller
+type deviceMetrics struct {
+	up       bool // Last refresh succeeded
+	snapshot epever.Snapshot
+	drift    map[string]float64 // Desired setting drift by register name, nil when not checked
+}
+
+func newCollector(legacy bool, staleAfter time.Duration, site siteConfig) *collector {
+	requestLabels := append([]string{"op", "block"}, deviceLabels...)
+	return &collector{
+		legacy:     legacy,
+		staleAfter: staleAfter,
+		site:       site,
+		devices:    map[*epever.Epever]*deviceMetrics{},
+		attempts: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "solar_modbus_attempts_total",
+			Help: "Modbus request attempts, retries included, by register block"}, requestLabels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "solar_modbus_errors_total",
+			Help: "Failed modbus request attempts by register block and error class"}, append([]string{"class"}, requestLabels...)),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "solar_modbus_attempt_duration_seconds",
+			Help: "Time taken by modbus request attempts, failed ones included", Buckets: prometheus.DefBuckets}, requestLabels),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "solar_modbus_reconnects_total",
+			Help: "Times the bus was connected again after losing its connection"}, []string{"device"}),
+	}
+}
+
+// device returns the metrics of a controller, adding it. Caller must hold the mutex.
+func (c *collector) device(ep *epever.Epever) *deviceMetrics {
+	d, ok := c.devices[ep]
+	if !ok {
+		d = &deviceMetrics{}
+		c.devices[ep] = d
+		c.order = append(c.order, ep)
+	}
+	return d
+}
+
+// update records a fresh snapshot of a controller
+func (c *collector) update(ep *epever.Epever, s epever.Snapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.device(ep).snapshot = s
+}
+
+// setUp records whether the last refresh of a controller's readings
+// succeeded. The last snapshot is still exported after a failure.
+func (c *collector) setUp(ep *epever.Epever, up bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.device(ep).up = up
+}
+
+// ObserveAttempt implements epever.Observer
+func (c *collector) ObserveAttempt(ep *epever.Epever, a epever.Attempt) {
+	labels := append([]string{a.Op(), a.Block()}, controllerLabels(ep)...)
+	c.attempts.WithLabelValues(labels...).Inc()
+	c.latency.WithLabelValues(labels...).Observe(a.Duration.Seconds())
+	if a.Err != nil {
+		c.errors.WithLabelValues(append([]string{a.Class.String()}, labels...)...).Inc()
+	}
+}
+
+// ObserveReconnect implements epever.Observer
+func (c *collector) ObserveReconnect(ep *epever.Epever) {
+	c.reconnects.WithLabelValues(ep.Bus().String()).Inc()
+}
+
+// updateDrift records how far each desired setting is from the controller's
+func (c *collector) updateDrift(ep *epever.Epever, s epever.Snapshot, desired epever.DesiredState) {
+	drift := map[string]float64{}
+	for _, r := range desired.Registers() {
+		drift[r.Name] = 0
+	}
+	for _, d := range desired.Drift(s) {
+		drift[d.Register.Name] = d.Got - d.Want
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.device(ep).drift = drift
+}
+
+// Describe implements prometheus.Collector
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, r := range registerDescs {
+		ch <- r.desc
+		if c.legacy && r.legacy != nil {
+			ch <- r.legacy
+		}
+		if r.stateSet != nil {
+			ch <- r.stateSet
+		}
+	}
+	for _, desc := range []*prometheus.Desc{solarRTCDrift, solarLoadConfigSeconds, solarConfigDrift, solarControllerInfo,
+		solarConfigPanels, solarConfigPowerWatts, solarConfigBatteries} {
+		ch <- desc
+	}
+	if c.legacy {
+		for _, desc := range []*prometheus.Desc{solarConfigNum, solarConfigTotalPower, solarConfigBatteryNum} {
+			ch <- desc
+		}
+	}
+	for _, desc := range []*prometheus.Desc{solarUp, solarLastRefresh} {
+		ch <- desc
+	}
+	c.attempts.Describe(ch)
+	c.errors.Describe(ch)
+	c.latency.Describe(ch)
+	c.reconnects.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, ep := range c.order {
+		d := c.devices[ep]
+		labels := controllerLabels(ep)
+		gauge := func(desc *prometheus.Desc, v float64, extra ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, append(extra, labels...)...)
+		}
+
+		taken := d.snapshot.Taken
+		if taken.IsZero() {
+			gauge(solarUp, 0)
+			continue
+		}
+		gauge(solarLastRefresh, float64(taken.UnixNano())/1e9)
+		if c.staleAfter > 0 && time.Since(taken) > c.staleAfter {
+			gauge(solarUp, 0)
+			continue
+		}
+		up := 0.0
+		if d.up {
+			up = 1
+		}
+		gauge(solarUp, up)
+
+		for _, r := range registerDescs {
+			ch <- prometheus.MustNewConstMetric(r.desc, r.valueType, r.reg.MetricValue(d.snapshot), labels...)
+			if c.legacy && r.legacy != nil {
+				gauge(r.legacy, r.reg.LegacyMetricValue(d.snapshot))
+			}
+			if r.stateSet != nil {
+				current := r.reg.State(d.snapshot)
+				for _, state := range r.states {
+					v := 0.0
+					if state == current {
+						v = 1
+					}
+					gauge(r.stateSet, v, state)
+				}
+			}
+		}
+		if !d.snapshot.RTCTaken.IsZero() {
+			gauge(solarRTCDrift, d.snapshot.RTC(timezone).Sub(d.snapshot.RTCTaken).Seconds())
+		}
+		gauge(solarControllerInfo, 1, d.snapshot.Model())
+
+		load := d.snapshot.LoadConfig()
+		for setting, seconds := range map[string]float64{
+			"working_time1": load.WorkingTime1.Seconds(),
+			"working_time2": load.WorkingTime2.Seconds(),
+			"night_length":  load.NightLength.Seconds(),
+			"turn_on1":      secondsOfDay(load.TurnOn1),
+			"turn_off1":     secondsOfDay(load.TurnOff1),
+			"turn_on2":      secondsOfDay(load.TurnOn2),
+			"turn_off2":     secondsOfDay(load.TurnOff2),
+		} {
+			gauge(solarLoadConfigSeconds, seconds, setting)
+		}
+
+		for register, drift := range d.drift {
+			gauge(solarConfigDrift, drift, register)
+		}
+	}
+
+	// Some statics metrics as well
+	ch <- prometheus.MustNewConstMetric(solarConfigPanels, prometheus.GaugeValue, float64(c.site.Panels))
+	ch <- prometheus.MustNewConstMetric(solarConfigPowerWatts, prometheus.GaugeValue, c.site.MaxPowerWatts)
+	ch <- prometheus.MustNewConstMetric(solarConfigBatteries, prometheus.GaugeValue, float64(c.site.Batteries))
+	if c.legacy {
+		ch <- prometheus.MustNewConstMetric(solarConfigNum, prometheus.GaugeValue, float64(c.site.Panels))
+		ch <- prometheus.MustNewConstMetric(solarConfigTotalPower, prometheus.GaugeValue, c.site.MaxPowerWatts)
+		ch <- prometheus.MustNewConstMetric(solarConfigBatteryNum, prometheus.GaugeValue, float64(c.site.Batteries))
+	}
+
+	c.attempts.Collect(ch)
+	c.errors.Collect(ch)
+	c.latency.Collect(ch)
+	c.reconnects.Collect(ch)
+}
+
+// controllerLabels are the device label values of a controller, in deviceLabels order
+func controllerLabels(ep *epever.Epever) []string {
+	return []string{ep.Bus().String(), strconv.Itoa(int(ep.SlaveID())), ep.Name()}
+}
+
+func secondsOfDay(t epever.TimeOfDay) float64 {
+	return float64(t.Hour)*3600 + float64(t.Min)*60 + float64(t.Sec)
+}
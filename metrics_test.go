@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"solar/epever"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorLabelsEachController(t *testing.T) {
+	house, err := epever.NewEpever("tcp://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus, err := epever.NewBus("tcp://127.0.0.1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shed := epever.NewEpeverOnBus(bus, 3, "shed")
+
+	metrics := newCollector(true, time.Minute, defaultConfig().Site)
+	if err := testutil.CollectAndCompare(metrics, strings.NewReader(""), "solar_battery_volts"); err != nil {
+		t.Errorf("controllers exported before they were refreshed: %v", err)
+	}
+	metrics.update(house, epever.Snapshot{Taken: time.Now(), BatteryVoltage: 26.5, HistGenerated: 1234.5, StatusChargingStatus: epever.PromoteCharging})
+	metrics.update(shed, epever.Snapshot{Taken: time.Now(), BatteryVoltage: 12.8})
+
+	want := `
+# HELP solar_battery_volts Battery array voltage
+# TYPE solar_battery_volts gauge
+solar_battery_volts{device="tcp://127.0.0.1:1",name="tcp://127.0.0.1:1#1",slave_id="1"} 26.5
+solar_battery_volts{device="tcp://127.0.0.1:2",name="shed",slave_id="3"} 12.8
+# HELP solar_generated_kilowatt_hours_total Generated total
+# TYPE solar_generated_kilowatt_hours_total counter
+solar_generated_kilowatt_hours_total{device="tcp://127.0.0.1:1",name="tcp://127.0.0.1:1#1",slave_id="1"} 1234.5
+solar_generated_kilowatt_hours_total{device="tcp://127.0.0.1:2",name="shed",slave_id="3"} 0
+# HELP solar_bat_voltage Battery array voltage
+# TYPE solar_bat_voltage gauge
+solar_bat_voltage{device="tcp://127.0.0.1:1",name="tcp://127.0.0.1:1#1",slave_id="1"} 26.5
+solar_bat_voltage{device="tcp://127.0.0.1:2",name="shed",slave_id="3"} 12.8
+# HELP solar_charging_state Status Charging Status, 1 for the current state
+# TYPE solar_charging_state gauge
+solar_charging_state{device="tcp://127.0.0.1:1",name="tcp://127.0.0.1:1#1",slave_id="1",state="EqualibriumCharging"} 0
+solar_charging_state{device="tcp://127.0.0.1:1",name="tcp://127.0.0.1:1#1",slave_id="1",state="Fault"} 0
+solar_charging_state{device="tcp://127.0.0.1:1",name="tcp://127.0.0.1:1#1",slave_id="1",state="NoCharging"} 0
+solar_charging_state{device="tcp://127.0.0.1:1",name="tcp://127.0.0.1:1#1",slave_id="1",state="PromoteCharging"} 1
+solar_charging_state{device="tcp://127.0.0.1:2",name="shed",slave_id="3",state="EqualibriumCharging"} 0
+solar_charging_state{device="tcp://127.0.0.1:2",name="shed",slave_id="3",state="Fault"} 0
+solar_charging_state{device="tcp://127.0.0.1:2",name="shed",slave_id="3",state="NoCharging"} 1
+solar_charging_state{device="tcp://127.0.0.1:2",name="shed",slave_id="3",state="PromoteCharging"} 0
+`
+	if err := testutil.CollectAndCompare(metrics, strings.NewReader(want),
+		"solar_battery_volts", "solar_generated_kilowatt_hours_total", "solar_bat_voltage", "solar_charging_state"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMetricNamesFollowConventions(t *testing.T) {
+	metrics := newCollector(false, time.Minute, defaultConfig().Site)
+	ep, err := epever.NewEpever("tcp://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics.update(ep, epever.Snapshot{Taken: time.Now()})
+	problems, err := testutil.CollectAndLint(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		// Energy is in kilowatt hours as everyone reads it, not joules
+		if strings.Contains(p.Metric, "_kilowatt_hours") {
+			continue
+		}
+		t.Errorf("%s: %s", p.Metric, p.Text)
+	}
+}
+
+func TestCollectorPollHealth(t *testing.T) {
+	ep, err := epever.NewEpever("tcp://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := newCollector(false, time.Minute, defaultConfig().Site)
+	metrics.setUp(ep, false)
+	metrics.ObserveAttempt(ep, epever.Attempt{Table: epever.InputRegister, Address: 0x3100, Quantity: 18,
+		Err: epever.ErrTimeout, Class: epever.ClassTimeout})
+
+	want := `
+# HELP solar_up 1 if the last refresh of the controller succeeded and its data is fresh, 0 otherwise
+# TYPE solar_up gauge
+solar_up{device="tcp://127.0.0.1:1",name="tcp://127.0.0.1:1#1",slave_id="1"} 0
+# HELP solar_modbus_errors_total Failed modbus request attempts by register block and error class
+# TYPE solar_modbus_errors_total counter
+solar_modbus_errors_total{block="input 0x3100+18",class="timeout",device="tcp://127.0.0.1:1",name="tcp://127.0.0.1:1#1",op="read",slave_id="1"} 1
+`
+	if err := testutil.CollectAndCompare(metrics, strings.NewReader(want),
+		"solar_up", "solar_modbus_errors_total", "solar_battery_volts", "solar_last_successful_refresh_timestamp_seconds"); err != nil {
+		t.Errorf("before the first refresh: %v", err)
+	}
+
+	metrics.setUp(ep, true)
+	metrics.update(ep, epever.Snapshot{Taken: time.Now()})
+	if got := testutil.CollectAndCount(metrics, "solar_up", "solar_last_successful_refresh_timestamp_seconds", "solar_battery_volts"); got != 3 {
+		t.Errorf("%d series after a refresh, want 3", got)
+	}
+
+	// Once the snapshot is too old its values go, and the controller is down
+	metrics.update(ep, epever.Snapshot{Taken: time.Now().Add(-time.Hour), BatteryVoltage: 26.5})
+	if got := testutil.CollectAndCount(metrics, "solar_battery_volts", "solar_battery_voltage_state", "solar_rtc_drift_seconds"); got != 0 {
+		t.Errorf("%d series exported from an hour old snapshot", got)
+	}
+	want = `
+# HELP solar_up 1 if the last refresh of the controller succeeded and its data is fresh, 0 otherwise
+# TYPE solar_up gauge
+solar_up{device="tcp://127.0.0.1:1",name="tcp://127.0.0.1:1#1",slave_id="1"} 0
+`
+	if err := testutil.CollectAndCompare(metrics, strings.NewReader(want), "solar_up"); err != nil {
+		t.Errorf("with stale data: %v", err)
+	}
+}